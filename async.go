@@ -0,0 +1,323 @@
+// @Author: openownworld
+// @Email:  openownworld@163.com
+// @File:   async.go
+// @Description: 异步输出，调用方只编码日志并放入有界环形队列，后台 goroutine 写入文件、终端或 socket
+
+package zlog
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap/zapcore"
+)
+
+// Enums async policy constants. 队列已满时的处理方式
+const (
+	AsyncBlock          = "block"            // 等待队列有空位
+	AsyncDropNewest     = "drop_newest"      // 丢弃新日志
+	AsyncDropOldest     = "drop_oldest"      // 丢弃队列中最旧的日志
+	AsyncDropBelowLevel = "drop_below_level" // 丢弃低于 DropLevel 的新日志，其余等待
+)
+
+const (
+	defaultAsyncBufferSize    = 8192
+	defaultAsyncFlushInterval = time.Second
+)
+
+var asyncPolicies = map[string]bool{
+	"":                  true,
+	AsyncBlock:          true,
+	AsyncDropNewest:     true,
+	AsyncDropOldest:     true,
+	AsyncDropBelowLevel: true,
+}
+
+// AsyncOptions 异步输出选项
+type AsyncOptions struct {
+	BufferSize    int           // 队列最多缓存的日志条数，默认 8192
+	Policy        string        // 队列已满时 block drop_newest drop_oldest drop_below_level，默认 block
+	DropLevel     Level         // drop_below_level 时低于该级别的日志被丢弃，默认 LevelWarn
+	FlushInterval time.Duration // 定时 Sync 底层输出的间隔，默认 1s
+}
+
+// asyncEntry 一条已编码的日志
+type asyncEntry struct {
+	level zapcore.Level
+	b     []byte
+}
+
+// AsyncWriter 有界环形队列，后台 goroutine 逐条写入 ws，socket 等按每次 Write 分帧的输出不受影响
+// Sync 等待队列写完并 Sync 底层输出，Close 写完剩余日志后退出，不关闭 ws
+type AsyncWriter struct {
+	name      string
+	ws        zapcore.WriteSyncer
+	policy    string
+	dropLevel zapcore.Level
+	interval  time.Duration
+	mu        sync.Mutex
+	notFull   *sync.Cond
+	ring      []asyncEntry
+	head      int
+	count     int
+	closed    bool
+	writeErr  error // 上次 Sync 之后的写入错误
+	dropped   atomic.Uint64
+	report    uint64 // 只在 run 中使用
+	wake      chan struct{}
+	flush     chan chan error
+	done      chan struct{}
+	stopped   chan struct{}
+}
+
+// NewAsyncWriter 创建异步输出，name 用于丢弃日志时的提示
+func NewAsyncWriter(name string, ws zapcore.WriteSyncer, opts AsyncOptions) (*AsyncWriter, error) {
+	policy := strings.ToLower(opts.Policy)
+	if !asyncPolicies[policy] {
+		return nil, fmt.Errorf("unknown async policy %q, want block, drop_newest, drop_oldest or drop_below_level", opts.Policy)
+	}
+	if policy == "" {
+		policy = AsyncBlock
+	}
+	if opts.BufferSize <= 0 {
+		opts.BufferSize = defaultAsyncBufferSize
+	}
+	if opts.FlushInterval <= 0 {
+		opts.FlushInterval = defaultAsyncFlushInterval
+	}
+	dropLevel, ok := levelToZapLevel[opts.DropLevel]
+	if !ok {
+		dropLevel = zapcore.WarnLevel
+	}
+	w := &AsyncWriter{
+		name:      name,
+		ws:        ws,
+		policy:    policy,
+		dropLevel: dropLevel,
+		interval:  opts.FlushInterval,
+		ring:      make([]asyncEntry, opts.BufferSize),
+		wake:      make(chan struct{}, 1),
+		flush:     make(chan chan error),
+		done:      make(chan struct{}),
+		stopped:   make(chan struct{}),
+	}
+	w.notFull = sync.NewCond(&w.mu)
+	go w.run()
+	return w, nil
+}
+
+// Dropped 队列已满或关闭后丢弃的日志条数
+func (w *AsyncWriter) Dropped() uint64 {
+	return w.dropped.Load()
+}
+
+// Len 队列中等待写入的日志条数
+func (w *AsyncWriter) Len() int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.count
+}
+
+// Write implements io.Writer. 按 info 级别放入队列，p 被复制
+func (w *AsyncWriter) Write(p []byte) (int, error) {
+	if !w.write(zapcore.InfoLevel, append([]byte(nil), p...)) {
+		w.dropped.Add(1)
+	}
+	return len(p), nil
+}
+
+// write 放入队列，b 不再被调用方修改，已关闭时返回 false，由调用方丢弃或直接写入
+func (w *AsyncWriter) write(level zapcore.Level, b []byte) bool {
+	w.mu.Lock()
+	for w.count == len(w.ring) && !w.closed {
+		if w.policy == AsyncDropNewest || (w.policy == AsyncDropBelowLevel && level < w.dropLevel) {
+			w.mu.Unlock()
+			w.dropped.Add(1)
+			return true
+		}
+		if w.policy == AsyncDropOldest {
+			w.ring[w.head] = asyncEntry{}
+			w.head = (w.head + 1) % len(w.ring)
+			w.count--
+			w.dropped.Add(1)
+			break
+		}
+		w.notFull.Wait()
+	}
+	if w.closed {
+		w.mu.Unlock()
+		return false
+	}
+	w.ring[(w.head+w.count)%len(w.ring)] = asyncEntry{level: level, b: b}
+	w.count++
+	w.mu.Unlock()
+	select {
+	case w.wake <- struct{}{}:
+	default:
+	}
+	return true
+}
+
+// Sync implements zapcore.WriteSyncer. 等待队列写完并 Sync 底层输出，返回期间的写入错误
+func (w *AsyncWriter) Sync() error {
+	req := make(chan error, 1)
+	select {
+	case w.flush <- req:
+		return <-req
+	case <-w.stopped:
+		return nil
+	}
+}
+
+// Close implements io.Closer. 写完剩余日志后退出，之后的日志被丢弃
+func (w *AsyncWriter) Close() error {
+	w.mu.Lock()
+	if w.closed {
+		w.mu.Unlock()
+		return nil
+	}
+	w.closed = true
+	w.notFull.Broadcast()
+	close(w.done)
+	w.mu.Unlock()
+	<-w.stopped
+	return nil
+}
+
+func (w *AsyncWriter) run() {
+	defer close(w.stopped)
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-w.wake:
+			w.drain()
+		case <-ticker.C:
+			w.drain()
+			_ = w.ws.Sync()
+			w.reportDropped()
+		case req := <-w.flush:
+			req <- w.sync()
+		case <-w.done:
+			_ = w.sync()
+			w.reportDropped()
+			return
+		}
+	}
+}
+
+// drain 写完队列中的日志，每次最多取出 256 条，取出后唤醒等待的调用方
+func (w *AsyncWriter) drain() {
+	batch := make([]asyncEntry, 0, min(256, len(w.ring)))
+	for {
+		w.mu.Lock()
+		for w.count > 0 && len(batch) < cap(batch) {
+			batch = append(batch, w.ring[w.head])
+			w.ring[w.head] = asyncEntry{}
+			w.head = (w.head + 1) % len(w.ring)
+			w.count--
+		}
+		w.notFull.Broadcast()
+		w.mu.Unlock()
+		if len(batch) == 0 {
+			return
+		}
+		for _, e := range batch {
+			if _, err := w.ws.Write(e.b); err != nil && w.writeErr == nil {
+				w.writeErr = err
+			}
+		}
+		batch = batch[:0]
+	}
+}
+
+// sync 写完队列并 Sync 底层输出
+func (w *AsyncWriter) sync() error {
+	w.drain()
+	err := errors.Join(w.writeErr, w.ws.Sync())
+	w.writeErr = nil
+	return err
+}
+
+func (w *AsyncWriter) reportDropped() {
+	if d := w.dropped.Load(); d > w.report {
+		fmt.Fprintf(os.Stderr, "%s zlog: async %s dropped %d log entries\n", getNowTimeMs(), w.name, d-w.report)
+		w.report = d
+	}
+}
+
+// asyncCore 在调用方 goroutine 编码，写入 AsyncWriter 队列，panic fatal 级别等待写完，队列已关闭时直接写入
+type asyncCore struct {
+	zapcore.LevelEnabler
+	enc zapcore.Encoder
+	w   *AsyncWriter
+}
+
+// NewAsyncCore 与 zapcore.NewCore 相同，但写入异步进行
+func NewAsyncCore(enc zapcore.Encoder, w *AsyncWriter, enab zapcore.LevelEnabler) zapcore.Core {
+	return &asyncCore{LevelEnabler: enab, enc: enc, w: w}
+}
+
+// With implements zapcore.Core.
+func (c *asyncCore) With(fields []zapcore.Field) zapcore.Core {
+	n := *c
+	n.enc = c.enc.Clone()
+	for _, f := range fields {
+		f.AddTo(n.enc)
+	}
+	return &n
+}
+
+// Check implements zapcore.Core.
+func (c *asyncCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(ent.Level) {
+		return ce.AddCore(ent, c)
+	}
+	return ce
+}
+
+// Write implements zapcore.Core.
+func (c *asyncCore) Write(ent zapcore.Entry, fields []zapcore.Field) error {
+	buf, err := c.enc.EncodeEntry(ent, fields)
+	if err != nil {
+		return err
+	}
+	b := append([]byte(nil), buf.Bytes()...)
+	buf.Free()
+	queued := c.w.write(ent.Level, b)
+	if ent.Level <= zapcore.ErrorLevel {
+		if !queued {
+			c.w.dropped.Add(1)
+		}
+		return nil
+	}
+	// 进程可能随后退出，队列已关闭时直接写入底层输出，不能静默丢弃
+	if !queued {
+		_, err := c.w.ws.Write(b)
+		return errors.Join(err, c.w.ws.Sync())
+	}
+	return c.w.Sync()
+}
+
+// Sync implements zapcore.Core.
+func (c *asyncCore) Sync() error {
+	return c.w.Sync()
+}
+
+// newSinkCore async 不为空时创建异步 core 并由 out 关闭，否则同 zapcore.NewCore
+func newSinkCore(name string, enc zapcore.Encoder, ws zapcore.WriteSyncer, enab zapcore.LevelEnabler, async *AsyncOptions, out *outputs) (zapcore.Core, error) {
+	if async == nil {
+		return zapcore.NewCore(enc, ws, enab), nil
+	}
+	w, err := NewAsyncWriter(name, ws, *async)
+	if err != nil {
+		return nil, err
+	}
+	out.async = append(out.async, w)
+	return NewAsyncCore(enc, w, enab), nil
+}
@@ -0,0 +1,158 @@
+package zlog
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"go.uber.org/zap/zapcore"
+)
+
+// gateWriter 第一次 Write 通知 entered，之后阻塞到 release 关闭
+type gateWriter struct {
+	mu      sync.Mutex
+	lines   []string
+	entered chan struct{}
+	release chan struct{}
+}
+
+func newGateWriter() *gateWriter {
+	return &gateWriter{entered: make(chan struct{}, 1), release: make(chan struct{})}
+}
+
+func (g *gateWriter) Write(p []byte) (int, error) {
+	select {
+	case g.entered <- struct{}{}:
+	default:
+	}
+	<-g.release
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.lines = append(g.lines, string(p))
+	return len(p), nil
+}
+
+func (g *gateWriter) Sync() error { return nil }
+
+// fillAsync 写入第一条并等待后台阻塞在底层 Write，再写满队列
+func fillAsync(t *testing.T, policy string) (*AsyncWriter, *gateWriter) {
+	g := newGateWriter()
+	w, err := NewAsyncWriter("test", g, AsyncOptions{BufferSize: 2, Policy: policy, DropLevel: LevelWarn})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = w.Close() })
+	w.write(zapcore.InfoLevel, []byte("1"))
+	select {
+	case <-g.entered:
+	case <-time.After(2 * time.Second):
+		t.Fatal("timeout waiting for write")
+	}
+	w.write(zapcore.InfoLevel, []byte("2"))
+	w.write(zapcore.InfoLevel, []byte("3"))
+	return w, g
+}
+
+func TestAsyncDropPolicies(t *testing.T) {
+	for policy, want := range map[string]string{
+		AsyncDropNewest: "1,2,3",
+		AsyncDropOldest: "1,3,4",
+	} {
+		w, g := fillAsync(t, policy)
+		w.write(zapcore.InfoLevel, []byte("4"))
+		close(g.release)
+		if err := w.Sync(); err != nil {
+			t.Fatal(err)
+		}
+		if got := strings.Join(g.lines, ","); got != want || w.Dropped() != 1 {
+			t.Fatalf("%s: got %s dropped %d, want %s", policy, got, w.Dropped(), want)
+		}
+	}
+}
+
+func TestAsyncBlock(t *testing.T) {
+	for _, policy := range []string{AsyncBlock, AsyncDropBelowLevel} {
+		w, g := fillAsync(t, policy)
+		// drop_below_level 丢弃 info，error 与 block 一样等待
+		level := zapcore.ErrorLevel
+		if policy == AsyncBlock {
+			level = zapcore.InfoLevel
+		} else {
+			w.write(zapcore.InfoLevel, []byte("info"))
+		}
+		done := make(chan struct{})
+		go func() {
+			w.write(level, []byte("4"))
+			close(done)
+		}()
+		select {
+		case <-done:
+			t.Fatalf("%s: write returned while queue is full", policy)
+		case <-time.After(50 * time.Millisecond):
+		}
+		close(g.release)
+		<-done
+		if err := w.Sync(); err != nil {
+			t.Fatal(err)
+		}
+		dropped := uint64(1)
+		if policy == AsyncBlock {
+			dropped = 0
+		}
+		if got := strings.Join(g.lines, ","); got != "1,2,3,4" || w.Dropped() != dropped {
+			t.Fatalf("%s: got %s dropped %d", policy, got, w.Dropped())
+		}
+	}
+}
+
+func TestAsyncPanicAfterClose(t *testing.T) {
+	g := newGateWriter()
+	close(g.release)
+	w, err := NewAsyncWriter("test", g, AsyncOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = w.Close()
+	enc := zapcore.NewConsoleEncoder(zapcore.EncoderConfig{MessageKey: "msg"})
+	core := NewAsyncCore(enc, w, zapcore.DebugLevel)
+	_ = core.Write(zapcore.Entry{Level: zapcore.InfoLevel, Message: "info"}, nil)
+	if err := core.Write(zapcore.Entry{Level: zapcore.FatalLevel, Message: "fatal"}, nil); err != nil {
+		t.Fatal(err)
+	}
+	// 关闭后 info 丢弃，fatal 直接写入
+	if got := strings.Join(g.lines, ""); got != "fatal\n" || w.Dropped() != 1 {
+		t.Fatalf("got %q dropped %d", got, w.Dropped())
+	}
+}
+
+func TestAsyncFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "async.log")
+	logger, err := New(WithFile(path, DefaultRotation(), SinkFormat("json"), SinkAsync(AsyncOptions{BufferSize: 16})))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 100; i++ {
+		logger.Infof("line %d", i)
+	}
+	if err := logger.Sync(); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := strings.Count(string(data), "\n"); n != 100 || !strings.Contains(string(data), `"msg":"line 99"`) {
+		t.Fatalf("unexpected file content, %d lines", n)
+	}
+	if err := logger.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	logger.Info("after close")
+	if z, ok := unwrapZLogger(logger); !ok || z.AsyncDropped() != 0 {
+		t.Fatal("unexpected dropped after close")
+	}
+}
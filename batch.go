@@ -0,0 +1,347 @@
+// @Author: openownworld
+// @Email:  openownworld@163.com
+// @File:   batch.go
+// @Description: http fluent 等批量输出的公共部分，按条数、字节数、时间分批，失败按指数退避重试
+
+package zlog
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	defaultBatchSize     = 1000
+	defaultBatchBytes    = 1 << 20
+	defaultBatchBuffer   = 10000
+	defaultBatchInterval = time.Second
+	defaultBatchRetries  = 10
+	defaultHTTPTimeout   = 10 * time.Second
+)
+
+// BatchOptions 批量输出选项
+type BatchOptions struct {
+	BatchSize     int           // 每批最多条数，默认 1000
+	BatchBytes    int           // 每批最多字节数，默认 1MB
+	FlushInterval time.Duration // 未满一批时的发送间隔，默认 1s
+	BufferSize    int           // 发送失败时最多缓存的条数，超出丢弃最旧的，默认 10000
+	MaxRetries    int           // 每批最多重试次数，超过后丢弃，默认 10
+	MinBackoff    time.Duration // 重试最小间隔，默认 100ms，失败后翻倍
+	MaxBackoff    time.Duration // 重试最大间隔，默认 30s
+}
+
+func (o BatchOptions) withDefaults() BatchOptions {
+	if o.BatchSize <= 0 {
+		o.BatchSize = defaultBatchSize
+	}
+	if o.BatchBytes <= 0 {
+		o.BatchBytes = defaultBatchBytes
+	}
+	if o.FlushInterval <= 0 {
+		o.FlushInterval = defaultBatchInterval
+	}
+	if o.BufferSize <= 0 {
+		o.BufferSize = defaultBatchBuffer
+	}
+	if o.MaxRetries <= 0 {
+		o.MaxRetries = defaultBatchRetries
+	}
+	if o.MinBackoff <= 0 {
+		o.MinBackoff = minReconnectBackoff
+	}
+	if o.MaxBackoff < o.MinBackoff {
+		o.MaxBackoff = maxReconnectBackoff
+	}
+	return o
+}
+
+// permanentError 不可重试的错误，如 http 4xx，该批直接丢弃
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string {
+	return e.err.Error()
+}
+
+func (e *permanentError) Unwrap() error {
+	return e.err
+}
+
+// batchItem 待发送的一条日志
+type batchItem[T any] struct {
+	v    T
+	size int
+}
+
+// batcher 缓存日志，后台按批调用 send，失败的一批保留在队首重试
+// send 返回 error 时，retry 为需要重试的下标，为空时整批重试
+// spill 不为空时，缓存已满、超过重试次数等无法发送的日志交给 spill 保存，保存失败才丢弃
+type batcher[T any] struct {
+	name    string
+	opts    BatchOptions
+	send    func(batch []T) (retry []int, err error)
+	spill   func(items []T) error
+	mu      sync.Mutex
+	queue   []batchItem[T]
+	bytes   int
+	closed  bool
+	dropped atomic.Uint64
+	spilled atomic.Uint64
+	report  uint64 // 只在 run 中使用
+	wake    chan struct{}
+	flush   chan chan error
+	done    chan struct{}
+	stopped chan struct{}
+}
+
+func newBatcher[T any](name string, opts BatchOptions, send func(batch []T) (retry []int, err error), spill func(items []T) error) *batcher[T] {
+	b := &batcher[T]{
+		name:    name,
+		opts:    opts.withDefaults(),
+		send:    send,
+		spill:   spill,
+		wake:    make(chan struct{}, 1),
+		flush:   make(chan chan error),
+		done:    make(chan struct{}),
+		stopped: make(chan struct{}),
+	}
+	go b.run()
+	return b
+}
+
+// post 加入一条日志，满一批时通知发送
+func (b *batcher[T]) post(v T, size int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		b.discard([]batchItem[T]{{v: v, size: size}})
+		return
+	}
+	b.queue = append(b.queue, batchItem[T]{v: v, size: size})
+	b.bytes += size
+	b.trim()
+	if len(b.queue) >= b.opts.BatchSize || b.bytes >= b.opts.BatchBytes {
+		select {
+		case b.wake <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// trim 调用方持有锁，超出 BufferSize 时丢弃或 spill 最旧的
+func (b *batcher[T]) trim() {
+	n := len(b.queue) - b.opts.BufferSize
+	if n <= 0 {
+		return
+	}
+	for _, item := range b.queue[:n] {
+		b.bytes -= item.size
+	}
+	b.discard(b.queue[:n])
+	b.queue = b.queue[n:]
+}
+
+// discard 无法发送的日志交给 spill 保存，没有 spill 或保存失败时丢弃，返回是否已保存
+func (b *batcher[T]) discard(items []batchItem[T]) bool {
+	if len(items) == 0 {
+		return true
+	}
+	if b.spill != nil {
+		values := make([]T, len(items))
+		for i, item := range items {
+			values[i] = item.v
+		}
+		if err := b.spill(values); err == nil {
+			b.spilled.Add(uint64(len(items)))
+			return true
+		}
+	}
+	b.dropped.Add(uint64(len(items)))
+	return false
+}
+
+// sync 立即发送缓存的日志，失败时返回 error 并保留日志等待重试
+func (b *batcher[T]) sync() error {
+	req := make(chan error, 1)
+	select {
+	case b.flush <- req:
+		return <-req
+	case <-b.stopped:
+		return nil
+	}
+}
+
+// close 尝试发送剩余日志后退出，发送失败的日志被丢弃
+func (b *batcher[T]) close() error {
+	b.mu.Lock()
+	if b.closed {
+		b.mu.Unlock()
+		return nil
+	}
+	b.closed = true
+	close(b.done)
+	b.mu.Unlock()
+	<-b.stopped
+	return nil
+}
+
+func (b *batcher[T]) run() {
+	defer close(b.stopped)
+	ticker := time.NewTicker(b.opts.FlushInterval)
+	defer ticker.Stop()
+	backoff := b.opts.MinBackoff
+	attempts := 0
+	var retry <-chan time.Time
+	send := func() error {
+		err := b.sendAll()
+		if err == nil {
+			backoff, attempts, retry = b.opts.MinBackoff, 0, nil
+			return nil
+		}
+		if attempts++; attempts > b.opts.MaxRetries {
+			// 超过重试次数丢弃当前一批
+			b.dropBatch()
+			backoff, attempts = b.opts.MinBackoff, 0
+		}
+		retry = time.After(backoff)
+		backoff = min(backoff*2, b.opts.MaxBackoff)
+		return err
+	}
+	for {
+		select {
+		case <-ticker.C:
+			if retry == nil {
+				_ = send()
+			}
+		case <-b.wake:
+			if retry == nil {
+				_ = send()
+			}
+		case <-retry:
+			retry = nil
+			_ = send()
+		case req := <-b.flush:
+			req <- send()
+		case <-b.done:
+			if err := b.sendAll(); err != nil {
+				b.mu.Lock()
+				b.discard(b.queue)
+				b.queue, b.bytes = nil, 0
+				b.mu.Unlock()
+			}
+			b.reportDropped()
+			return
+		}
+	}
+}
+
+// next 取出下一批，不超过 BatchSize 条和 BatchBytes 字节，至少一条
+func (b *batcher[T]) next() []batchItem[T] {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	n, size := 0, 0
+	for n < len(b.queue) && n < b.opts.BatchSize {
+		if n > 0 && size+b.queue[n].size > b.opts.BatchBytes {
+			break
+		}
+		size += b.queue[n].size
+		n++
+	}
+	batch := b.queue[:n:n]
+	b.queue = b.queue[n:]
+	b.bytes -= size
+	return batch
+}
+
+// sendAll 按批发送，失败的一批或其中需要重试的部分放回队首，不可重试的错误直接丢弃该批
+func (b *batcher[T]) sendAll() error {
+	for {
+		batch := b.next()
+		if len(batch) == 0 {
+			return nil
+		}
+		values := make([]T, len(batch))
+		for i, item := range batch {
+			values[i] = item.v
+		}
+		retry, err := b.send(values)
+		var perr *permanentError
+		if errors.As(err, &perr) {
+			if !b.discard(batch) {
+				fmt.Fprintf(os.Stderr, "%s zlog: %s dropped %d log entries: %v\n", getNowTimeMs(), b.name, len(batch), err)
+				b.report += uint64(len(batch))
+			}
+			continue
+		}
+		if err != nil {
+			if len(retry) > 0 {
+				// 部分失败，其余已成功或已丢弃
+				failed := make([]batchItem[T], len(retry))
+				for i, idx := range retry {
+					failed[i] = batch[idx]
+				}
+				batch = failed
+			}
+			b.mu.Lock()
+			b.queue = append(batch, b.queue...)
+			for _, item := range batch {
+				b.bytes += item.size
+			}
+			b.trim()
+			b.mu.Unlock()
+			return err
+		}
+		b.reportDropped()
+	}
+}
+
+// dropBatch 丢弃队首一批
+func (b *batcher[T]) dropBatch() {
+	b.discard(b.next())
+}
+
+// reject 不可重试的日志交给 spill 保存，保存失败时丢弃并输出原因，只在 send 中调用
+// 服务端逐条拒绝时由 send 调用，其余日志正常返回
+func (b *batcher[T]) reject(values []T, err error) {
+	items := make([]batchItem[T], len(values))
+	for i, v := range values {
+		items[i] = batchItem[T]{v: v}
+	}
+	if !b.discard(items) {
+		fmt.Fprintf(os.Stderr, "%s zlog: %s dropped %d log entries: %v\n", getNowTimeMs(), b.name, len(items), err)
+		b.report += uint64(len(items))
+	}
+}
+
+func (b *batcher[T]) reportDropped() {
+	if d := b.dropped.Load(); d > b.report {
+		fmt.Fprintf(os.Stderr, "%s zlog: %s dropped %d log entries\n", getNowTimeMs(), b.name, d-b.report)
+		b.report = d
+	}
+}
+
+// postHTTP 发送请求，2xx 成功，429 5xx 和网络错误可重试，其他状态码不可重试
+func postHTTP(client *http.Client, req *http.Request) error {
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return nil
+	}
+	err = fmt.Errorf("%s %s: %s %s", req.Method, req.URL.Redacted(), resp.Status, bytes.TrimSpace(body))
+	if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500 {
+		return err
+	}
+	return &permanentError{err: err}
+}
@@ -0,0 +1,211 @@
+// @Author: openownworld
+// @Email:  openownworld@163.com
+// @File:   config.go
+// @Description: ini yaml json toml 配置加载，key 与 Config 的 ini tag 一致
+
+package zlog
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"github.com/go-ini/ini"
+	"gopkg.in/yaml.v3"
+)
+
+// ConfigFormat 配置文件格式
+type ConfigFormat string
+
+// Enums config format constants.
+const (
+	FormatINI  ConfigFormat = "ini"
+	FormatYAML ConfigFormat = "yaml"
+	FormatJSON ConfigFormat = "json"
+	FormatTOML ConfigFormat = "toml"
+)
+
+// FormatByExt 按文件扩展名选择格式，未知扩展名按 ini 处理
+func FormatByExt(filename string) ConfigFormat {
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".yaml", ".yml":
+		return FormatYAML
+	case ".json":
+		return FormatJSON
+	case ".toml":
+		return FormatTOML
+	default:
+		return FormatINI
+	}
+}
+
+// LoadConfigFile 按扩展名加载配置文件，section 为嵌套的配置节，如 logging 或 app.logging，为空表示顶层
+// 未配置的项使用 GetDefaultConfig 的默认值
+func LoadConfigFile(filename, section string) (Config, error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return GetDefaultConfig(), err
+	}
+	return LoadConfig(data, FormatByExt(filename), section)
+}
+
+// LoadConfigReader 按指定格式加载配置
+func LoadConfigReader(reader io.Reader, format ConfigFormat, section string) (Config, error) {
+	data, err := ioutil.ReadAll(reader)
+	if err != nil {
+		return GetDefaultConfig(), err
+	}
+	return LoadConfig(data, format, section)
+}
+
+// LoadConfig 按指定格式解析配置，未配置的项使用 GetDefaultConfig 的默认值
+func LoadConfig(data []byte, format ConfigFormat, section string) (Config, error) {
+	logConfig := GetDefaultConfig()
+	if format == FormatINI || format == "" {
+		p, err := ini.Load(data)
+		if err != nil {
+			return logConfig, err
+		}
+		s, err := p.GetSection(section)
+		if err != nil {
+			return logConfig, err
+		}
+		if err := s.MapTo(&logConfig); err != nil {
+			return logConfig, err
+		}
+		return logConfig, nil
+	}
+	m := map[string]interface{}{}
+	switch format {
+	case FormatYAML:
+		if err := yaml.Unmarshal(data, &m); err != nil {
+			return logConfig, err
+		}
+	case FormatJSON:
+		d := json.NewDecoder(bytes.NewReader(data))
+		d.UseNumber()
+		if err := d.Decode(&m); err != nil {
+			return logConfig, err
+		}
+	case FormatTOML:
+		if err := toml.Unmarshal(data, &m); err != nil {
+			return logConfig, err
+		}
+	default:
+		return logConfig, fmt.Errorf("unknown config format %q", format)
+	}
+	if section != "" {
+		for _, name := range strings.Split(section, ".") {
+			sub, ok := m[name].(map[string]interface{})
+			if !ok {
+				return logConfig, fmt.Errorf("section %q not found", section)
+			}
+			m = sub
+		}
+	}
+	if err := mapToConfig(m, &logConfig); err != nil {
+		return logConfig, err
+	}
+	return logConfig, nil
+}
+
+// configKey key 统一为小写并去掉 _ -，logFileName log_file_name log-file-name 等价
+func configKey(key string) string {
+	return strings.ToLower(strings.NewReplacer("_", "", "-", "").Replace(key))
+}
+
+// configFields Config 字段，key 为 configKey(ini tag)
+func configFields() map[string]int {
+	t := reflect.TypeOf(Config{})
+	fields := make(map[string]int, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		tag := t.Field(i).Tag.Get("ini")
+		if tag == "" || tag == "-" {
+			continue
+		}
+		fields[configKey(tag)] = i
+	}
+	return fields
+}
+
+// mapToConfig 按 ini tag 把 map 中的值写入 Config，忽略未知 key
+func mapToConfig(m map[string]interface{}, logConfig *Config) error {
+	fields := configFields()
+	v := reflect.ValueOf(logConfig).Elem()
+	for key, value := range m {
+		i, ok := fields[configKey(key)]
+		if !ok {
+			continue
+		}
+		if err := setConfigField(v.Field(i), value); err != nil {
+			return fmt.Errorf("config key %q: %v", key, err)
+		}
+	}
+	return nil
+}
+
+// setConfigField 按字段类型转换 value，字符串会按字段类型解析
+func setConfigField(field reflect.Value, value interface{}) error {
+	switch field.Kind() {
+	case reflect.String:
+		switch x := value.(type) {
+		case string:
+			field.SetString(x)
+		case bool, int, int64, uint64, float64, json.Number:
+			field.SetString(fmt.Sprint(x))
+		default:
+			return fmt.Errorf("cannot use %T as string", value)
+		}
+	case reflect.Bool:
+		switch x := value.(type) {
+		case bool:
+			field.SetBool(x)
+		case string:
+			b, err := strconv.ParseBool(strings.TrimSpace(x))
+			if err != nil {
+				return fmt.Errorf("invalid bool %q", x)
+			}
+			field.SetBool(b)
+		default:
+			return fmt.Errorf("cannot use %T as bool", value)
+		}
+	case reflect.Int, reflect.Int64:
+		switch x := value.(type) {
+		case int:
+			field.SetInt(int64(x))
+		case int64:
+			field.SetInt(x)
+		case uint64:
+			field.SetInt(int64(x))
+		case float64:
+			if x != float64(int64(x)) {
+				return fmt.Errorf("invalid integer %v", x)
+			}
+			field.SetInt(int64(x))
+		case json.Number:
+			n, err := x.Int64()
+			if err != nil {
+				return fmt.Errorf("invalid integer %q", x.String())
+			}
+			field.SetInt(n)
+		case string:
+			n, err := strconv.ParseInt(strings.TrimSpace(x), 10, 64)
+			if err != nil {
+				return fmt.Errorf("invalid integer %q", x)
+			}
+			field.SetInt(n)
+		default:
+			return fmt.Errorf("cannot use %T as integer", value)
+		}
+	default:
+		return fmt.Errorf("unsupported field type %s", field.Type())
+	}
+	return nil
+}
@@ -0,0 +1,125 @@
+package zlog
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLoadConfig(t *testing.T) {
+	cases := []struct {
+		format  ConfigFormat
+		section string
+		data    string
+	}{
+		{FormatINI, "", "level = warn\nmaxSize = 50\nfileLoggerJSON = true\nsocketPort = 9991\n"},
+		{FormatINI, "logging", "[app]\nname = a\n[logging]\nlevel = warn\nmaxSize = 50\nfileLoggerJSON = true\nsocketPort = 9991\n"},
+		{FormatYAML, "app.logging", "app:\n  logging:\n    level: warn\n    maxSize: 50\n    fileLoggerJSON: true\n    socketPort: 9991\n"},
+		{FormatJSON, "logging", `{"logging":{"level":"warn","maxSize":50,"fileLoggerJSON":true,"socketPort":"9991"}}`},
+		{FormatTOML, "logging", "[logging]\nlevel = \"warn\"\nmax_size = 50\nfileLoggerJSON = true\nsocketPort = 9991\n"},
+	}
+	for _, c := range cases {
+		cfg, err := LoadConfig([]byte(c.data), c.format, c.section)
+		if err != nil {
+			t.Fatalf("%s %s: %v", c.format, c.section, err)
+		}
+		if cfg.Level != "warn" || cfg.MaxSize != 50 || !cfg.FileLoggerJSON || cfg.SocketPort != "9991" {
+			t.Fatalf("%s %s: unexpected config %+v", c.format, c.section, cfg)
+		}
+		if cfg.LogFileName != GetDefaultConfig().LogFileName {
+			t.Fatalf("%s %s: default not kept %q", c.format, c.section, cfg.LogFileName)
+		}
+	}
+	if _, err := LoadConfig([]byte(`{"maxSize":"big"}`), FormatJSON, ""); err == nil || !strings.Contains(err.Error(), "maxSize") {
+		t.Fatalf("expect maxSize error, got %v", err)
+	}
+	if _, err := LoadConfig([]byte("level: warn\n"), FormatYAML, "logging"); err == nil {
+		t.Fatal("expect section not found error")
+	}
+	if FormatByExt("app.yml") != FormatYAML || FormatByExt("log.ini") != FormatINI {
+		t.Fatal("unexpected format by ext")
+	}
+}
+
+func TestApplyEnv(t *testing.T) {
+	t.Setenv("ZLOG_LEVEL", "warn")
+	t.Setenv("ZLOG_FILELOGGERJSON", "true")
+	t.Setenv("ZLOG_SOCKET_IP", "10.0.0.5")
+	t.Setenv("ZLOG_MAXSIZE", "big")
+	cfg := GetDefaultConfig()
+	err := ApplyEnv(&cfg)
+	if err == nil || !strings.Contains(err.Error(), "ZLOG_MAXSIZE") {
+		t.Fatalf("expect ZLOG_MAXSIZE error, got %v", err)
+	}
+	if cfg.Level != "warn" || !cfg.FileLoggerJSON || cfg.SocketIP != "10.0.0.5" || cfg.MaxSize != GetDefaultConfig().MaxSize {
+		t.Fatalf("unexpected config %+v", cfg)
+	}
+	cfg = GetDefaultConfig()
+	if err := ApplyEnvPrefix(&cfg, "APP_LOG_"); err != nil || cfg.Level != GetDefaultConfig().Level {
+		t.Fatalf("unexpected prefix result %v %+v", err, cfg)
+	}
+}
+
+func TestConfigValidate(t *testing.T) {
+	if err := GetDefaultConfig().Validate(); err != nil {
+		t.Fatalf("default config invalid: %v", err)
+	}
+	cfg := GetDefaultConfig()
+	cfg.Level = "verbose"
+	cfg.ErrorFileLevel = "info"
+	cfg.FileLogger = false
+	cfg.ErrorFileEnable = true
+	cfg.SocketLoggerEnable = true
+	cfg.SocketType = "sctp"
+	cfg.SocketPort = "99999"
+	cfg.ServiceKey = "app"
+	err := cfg.Validate()
+	if err == nil {
+		t.Fatal("expect invalid config")
+	}
+	for _, key := range []string{"level:", "errorFileLevel:", "errorFileEnable:", "socketType:", "socketPort:", "serviceKey:"} {
+		if !strings.Contains(err.Error(), key) {
+			t.Fatalf("missing %s in %v", key, err)
+		}
+	}
+	before := GetDefaultLogger()
+	if err := InitLog(cfg); err == nil {
+		t.Fatal("expect InitLog error")
+	}
+	if GetDefaultLogger() != before {
+		t.Fatal("invalid config must not replace default logger")
+	}
+}
+
+func TestTimeFormat(t *testing.T) {
+	dir := t.TempDir()
+	for _, format := range []string{"", "custom", "ISO8601"} {
+		cfg := GetDefaultConfig()
+		cfg.ConsoleLogger = false
+		cfg.TimeFormat = format
+		cfg.LogFileName = filepath.Join(dir, fmt.Sprintf("%s.log", format))
+		logger, err := newZLogger(cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		logger.Info("time")
+		_ = logger.Close(context.Background())
+		b, _ := os.ReadFile(cfg.LogFileName)
+		// 2006-01-02 15:04:05.000 与 2006-01-02T15:04:05.000Z0700
+		if iso := len(b) > 10 && b[10] == 'T'; iso != (format == "ISO8601") {
+			t.Fatalf("timeFormat %q: %s", format, b)
+		}
+	}
+	cfg := GetDefaultConfig()
+	cfg.CustomTimeEnable, cfg.TimeFormat = true, "rfc3339"
+	if err := cfg.Validate(); err == nil || !strings.Contains(err.Error(), "customTimeEnable:") {
+		t.Fatalf("expect customTimeEnable error, got %v", err)
+	}
+	cfg.CustomTimeEnable, cfg.TimeFormat = false, "unix"
+	if err := cfg.Validate(); err == nil || !strings.Contains(err.Error(), "timeFormat:") {
+		t.Fatalf("expect timeFormat error, got %v", err)
+	}
+}
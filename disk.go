@@ -0,0 +1,262 @@
+// @Author: openownworld
+// @Email:  openownworld@163.com
+// @File:   disk.go
+// @Description: 日志总大小限制，超出时删除最旧的备份；磁盘剩余空间不足时文件只写 error 及以上级别
+
+package zlog
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap/zapcore"
+)
+
+const defaultDiskCheckInterval = 10 * time.Second
+
+// DiskLimit 日志文件占用磁盘的限制，作用于所有 WithFile 或 logFileName errorFileName
+type DiskLimit struct {
+	MaxTotalSize  int           // Mb 日志文件及其备份的总大小，超出时从最旧的备份开始删除，0 不限制
+	MinFreeDisk   int           // Mb 磁盘剩余空间低于该值时文件只写 error 及以上级别并输出警告，0 不检查
+	CheckInterval time.Duration // 检查间隔，默认 10s
+}
+
+// diskFile 受限制的一个日志文件
+type diskFile struct {
+	path string
+	w    io.Writer
+}
+
+// lumberjackTimeFormat lumberjack 备份文件名中的时间格式
+const lumberjackTimeFormat = "2006-01-02T15-04-05.000"
+
+// list 日志文件及其备份，可带 .gz
+// lumberjack 备份为 <name>-2006-01-02T15-04-05.000<ext>，按时间切割的文件见 TimeRotateWriter.list
+func (f diskFile) list() []string {
+	if w, ok := f.w.(*TimeRotateWriter); ok {
+		files, _ := w.list()
+		paths := make([]string, 0, len(files))
+		for _, rf := range files {
+			paths = append(paths, filepath.Clean(rf.path))
+		}
+		return paths
+	}
+	paths := []string{filepath.Clean(f.path)}
+	dir := filepath.Dir(f.path)
+	ext := filepath.Ext(f.path)
+	prefix := strings.TrimSuffix(filepath.Base(f.path), ext) + "-"
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return paths
+	}
+	for _, e := range entries {
+		name := strings.TrimSuffix(e.Name(), ".gz")
+		if e.IsDir() || !strings.HasPrefix(name, prefix) || !strings.HasSuffix(name, ext) {
+			continue
+		}
+		if _, err := time.Parse(lumberjackTimeFormat, strings.TrimSuffix(strings.TrimPrefix(name, prefix), ext)); err != nil {
+			continue
+		}
+		paths = append(paths, filepath.Join(dir, e.Name()))
+	}
+	return paths
+}
+
+// diskGuard 定时检查日志总大小和磁盘剩余空间
+type diskGuard struct {
+	limit DiskLimit
+	files []diskFile
+	cores []zapcore.Core                   // 未过滤的文件 core，用于写入磁盘空间警告
+	free  func(dir string) (uint64, error) // 目录所在文件系统的剩余空间，测试时替换
+	low   atomic.Bool
+	once  sync.Once
+	done  chan struct{}
+	wg    sync.WaitGroup
+}
+
+func newDiskGuard(limit DiskLimit) *diskGuard {
+	if limit.CheckInterval <= 0 {
+		limit.CheckInterval = defaultDiskCheckInterval
+	}
+	return &diskGuard{limit: limit, free: diskFree, done: make(chan struct{})}
+}
+
+// add 加入日志文件，返回磁盘空间不足时只写 error 及以上级别的 core
+func (g *diskGuard) add(path string, w io.Writer, core zapcore.Core) zapcore.Core {
+	g.files = append(g.files, diskFile{path: path, w: w})
+	g.cores = append(g.cores, core)
+	return &diskCore{Core: core, g: g}
+}
+
+// start 立即检查一次，之后定时检查
+func (g *diskGuard) start() {
+	g.check()
+	g.wg.Add(1)
+	go func() {
+		defer g.wg.Done()
+		ticker := time.NewTicker(g.limit.CheckInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				g.check()
+			case <-g.done:
+				return
+			}
+		}
+	}()
+}
+
+// Close implements io.Closer.
+func (g *diskGuard) Close() error {
+	g.once.Do(func() { close(g.done) })
+	g.wg.Wait()
+	return nil
+}
+
+func (g *diskGuard) check() {
+	if g.limit.MaxTotalSize > 0 {
+		if err := g.trim(int64(g.limit.MaxTotalSize) * 1024 * 1024); err != nil {
+			fmt.Fprintf(os.Stderr, "%s zlog: trim log files: %v\n", getNowTimeMs(), err)
+		}
+	}
+	if g.limit.MinFreeDisk > 0 && len(g.files) > 0 {
+		free, ok := g.minFree()
+		if !ok {
+			return
+		}
+		floor := uint64(g.limit.MinFreeDisk) * 1024 * 1024
+		g.setLow(free < floor, free)
+	}
+}
+
+// minFree 所有日志文件所在目录中最小的剩余空间，errorFileName 可能在另一个文件系统上
+func (g *diskGuard) minFree() (uint64, bool) {
+	var lowest uint64
+	ok := false
+	seen := map[string]bool{}
+	for _, f := range g.files {
+		dir := filepath.Dir(f.path)
+		if seen[dir] {
+			continue
+		}
+		seen[dir] = true
+		free, err := g.free(dir)
+		if err != nil {
+			continue
+		}
+		if !ok || free < lowest {
+			lowest, ok = free, true
+		}
+	}
+	return lowest, ok
+}
+
+// setLow 切换状态时输出警告到 stderr 和日志文件
+func (g *diskGuard) setLow(low bool, free uint64) {
+	if g.low.Swap(low) == low {
+		return
+	}
+	msg := fmt.Sprintf("disk free space %dMb is below minFreeDisk %dMb, only error logs are written to files", free>>20, g.limit.MinFreeDisk)
+	level := zapcore.WarnLevel
+	if !low {
+		msg = fmt.Sprintf("disk free space %dMb recovered, all levels are written to files", free>>20)
+		level = zapcore.InfoLevel
+	}
+	fmt.Fprintf(os.Stderr, "%s zlog: %s\n", getNowTimeMs(), msg)
+	ent := zapcore.Entry{Level: level, Time: time.Now(), LoggerName: "zlog", Message: msg}
+	for _, c := range g.cores {
+		if ce := c.Check(ent, nil); ce != nil {
+			ce.Write()
+		}
+	}
+}
+
+// diskBackup 一个日志文件或备份
+type diskBackup struct {
+	path    string
+	size    int64
+	modTime time.Time
+}
+
+// trim 统计日志文件及其备份的总大小，超出 max 时按修改时间从旧到新删除备份，正在写入的文件不删除
+func (g *diskGuard) trim(max int64) error {
+	active := map[string]bool{}
+	for _, f := range g.files {
+		active[filepath.Clean(f.path)] = true
+		if w, ok := f.w.(*TimeRotateWriter); ok {
+			if name := w.Filename(); name != "" {
+				active[filepath.Clean(name)] = true
+			}
+		}
+	}
+	seen := map[string]bool{}
+	var total int64
+	var backups []diskBackup
+	for _, f := range g.files {
+		for _, path := range f.list() {
+			if seen[path] {
+				continue
+			}
+			info, err := os.Stat(path)
+			if err != nil || info.IsDir() {
+				continue
+			}
+			seen[path] = true
+			total += info.Size()
+			if !active[path] {
+				backups = append(backups, diskBackup{path: path, size: info.Size(), modTime: info.ModTime()})
+			}
+		}
+	}
+	sort.Slice(backups, func(i, j int) bool {
+		return backups[i].modTime.Before(backups[j].modTime)
+	})
+	var errs []error
+	for _, b := range backups {
+		if total <= max {
+			break
+		}
+		if err := os.Remove(b.path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			errs = append(errs, err)
+			continue
+		}
+		total -= b.size
+	}
+	return errors.Join(errs...)
+}
+
+// diskCore 磁盘剩余空间不足时只写 error 及以上级别
+type diskCore struct {
+	zapcore.Core
+	g *diskGuard
+}
+
+// Enabled implements zapcore.LevelEnabler.
+func (c *diskCore) Enabled(lvl zapcore.Level) bool {
+	if c.g.low.Load() && lvl < zapcore.ErrorLevel {
+		return false
+	}
+	return c.Core.Enabled(lvl)
+}
+
+// With implements zapcore.Core.
+func (c *diskCore) With(fields []zapcore.Field) zapcore.Core {
+	return &diskCore{Core: c.Core.With(fields), g: c.g}
+}
+
+// Check implements zapcore.Core.
+func (c *diskCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.g.low.Load() && ent.Level < zapcore.ErrorLevel {
+		return ce
+	}
+	return c.Core.Check(ent, ce)
+}
@@ -0,0 +1,14 @@
+//go:build !linux && !darwin && !freebsd
+
+// @Author: openownworld
+// @Email:  openownworld@163.com
+// @File:   disk_other.go
+// @Description: 其他平台不支持获取磁盘剩余空间，minFreeDisk 不生效
+
+package zlog
+
+import "errors"
+
+func diskFree(dir string) (uint64, error) {
+	return 0, errors.New("free disk space is only supported on linux, darwin and freebsd")
+}
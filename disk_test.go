@@ -0,0 +1,115 @@
+package zlog
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestDiskTrim(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Now()
+	files := []struct {
+		name string
+		size int
+		age  time.Duration
+	}{
+		{"log.log", 512, 0},
+		{"error.log", 512, 0},
+		{"log-2026-10-15T00-00-00.000.log", 512, 3 * time.Hour},
+		{"error-2026-10-16T00-00-00.000.log.gz", 512, 2 * time.Hour},
+		{"log-2026-10-17T00-00-00.000.log", 512, time.Hour},
+		{"app.2026-10-13.log", 512, 6 * time.Hour},
+		// 其他程序的文件，名称相近也不删除
+		{"other.log", 2048, 4 * time.Hour},
+		{"log-worker.log", 2048, 5 * time.Hour},
+		{"log.access.log", 2048, 5 * time.Hour},
+		{"app.access.log", 512, 7 * time.Hour},
+	}
+	for _, f := range files {
+		path := filepath.Join(dir, f.name)
+		if err := os.WriteFile(path, make([]byte, f.size<<10), 0600); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(path, now.Add(-f.age), now.Add(-f.age)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	g := newDiskGuard(DiskLimit{MaxTotalSize: 2})
+	g.add(filepath.Join(dir, "log.log"), nil, zapcore.NewNopCore())
+	g.add(filepath.Join(dir, "error.log"), nil, zapcore.NewNopCore())
+	app := &TimeRotateWriter{prefix: filepath.Join(dir, "app"), ext: ".log", period: RotateDaily, now: time.Now}
+	g.add(filepath.Join(dir, "app.log"), app, zapcore.NewNopCore())
+	g.check()
+	got := strings.Join(dirFiles(t, dir), ",")
+	if got != "app.access.log,error-2026-10-16T00-00-00.000.log.gz,error.log,log-2026-10-17T00-00-00.000.log,log-worker.log,log.access.log,log.log,other.log" {
+		t.Fatalf("unexpected files %s", got)
+	}
+}
+
+func TestDiskLowErrorsOnly(t *testing.T) {
+	core, logs := observer.New(zapcore.DebugLevel)
+	g := newDiskGuard(DiskLimit{MinFreeDisk: 100})
+	c := g.add("log.log", nil, core).With([]zapcore.Field{{Key: "k", Type: zapcore.StringType, String: "v"}})
+	write := func(level zapcore.Level) {
+		if ce := c.Check(zapcore.Entry{Level: level, Message: level.String()}, nil); ce != nil {
+			ce.Write()
+		}
+	}
+	g.setLow(true, 10<<20)
+	write(zapcore.InfoLevel)
+	write(zapcore.ErrorLevel)
+	g.setLow(false, 200<<20)
+	write(zapcore.InfoLevel)
+	var got []string
+	for _, e := range logs.All() {
+		got = append(got, e.Level.String()+":"+e.Message)
+	}
+	if len(got) != 4 || !strings.HasPrefix(got[0], "warn:disk free space 10Mb is below minFreeDisk 100Mb") ||
+		got[1] != "error:error" || !strings.HasPrefix(got[2], "info:disk free space 200Mb recovered") || got[3] != "info:info" {
+		t.Fatalf("unexpected entries %q", got)
+	}
+}
+
+func TestDiskLowestFree(t *testing.T) {
+	g := newDiskGuard(DiskLimit{MinFreeDisk: 100})
+	g.free = func(dir string) (uint64, error) {
+		if dir == filepath.Join("b", "logs") {
+			return 10 << 20, nil
+		}
+		return 1000 << 20, nil
+	}
+	g.add(filepath.Join("a", "logs", "log.log"), nil, zapcore.NewNopCore())
+	g.add(filepath.Join("b", "logs", "error.log"), nil, zapcore.NewNopCore())
+	g.check()
+	if !g.low.Load() {
+		t.Fatal("expect low disk on error file directory")
+	}
+}
+
+func TestDiskLimitOption(t *testing.T) {
+	dir := t.TempDir()
+	if _, err := diskFree(dir); err != nil {
+		t.Skip(err)
+	}
+	path := filepath.Join(dir, "log.log")
+	logger, err := New(WithFile(path, DefaultRotation(), SinkFormat("json")), WithDiskLimit(DiskLimit{MinFreeDisk: 1 << 30}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	logger.Info("dropped")
+	logger.Error("kept")
+	if err := logger.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	b, _ := os.ReadFile(path)
+	if strings.Contains(string(b), "dropped") || !strings.Contains(string(b), "kept") || !strings.Contains(string(b), "below minFreeDisk") {
+		t.Fatalf("unexpected file content %s", b)
+	}
+}
@@ -0,0 +1,19 @@
+//go:build linux || darwin || freebsd
+
+// @Author: openownworld
+// @Email:  openownworld@163.com
+// @File:   disk_unix.go
+// @Description: 磁盘剩余空间
+
+package zlog
+
+import "golang.org/x/sys/unix"
+
+// diskFree 目录所在文件系统非特权用户可用的字节数
+func diskFree(dir string) (uint64, error) {
+	var st unix.Statfs_t
+	if err := unix.Statfs(dir, &st); err != nil {
+		return 0, err
+	}
+	return uint64(st.Bavail) * uint64(st.Bsize), nil
+}
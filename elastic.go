@@ -0,0 +1,287 @@
+// @Author: openownworld
+// @Email:  openownworld@163.com
+// @File:   elastic.go
+// @Description: Elasticsearch / OpenSearch _bulk 输出，按 index 模板写入，逐条处理部分失败
+
+package zlog
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"go.uber.org/zap/zapcore"
+)
+
+const (
+	defaultElasticIndex      = "logs-{service}-{date}"
+	defaultElasticDateLayout = "2006.01.02"
+)
+
+// ElasticOptions Elasticsearch / OpenSearch 输出选项
+type ElasticOptions struct {
+	URL        string       // 集群地址 http://127.0.0.1:9200
+	Index      string       // index 模板，{date} {date:2006.01} 为日志时间，{key} 替换为字段值(level 为级别，logger 为命名 logger 名称)，其余部分原样保留，默认 logs-{service}-{date}
+	ServiceKey string       // {service} 对应的字段名，与 Config.ServiceKey 一致，默认 service
+	Username   string       // basic 认证
+	Password   string       // basic 认证
+	APIKey     string       // Authorization: ApiKey，base64 编码的 id:api_key
+	Header     http.Header  // 额外的请求头
+	Client     *http.Client // 默认超时 10s 的 http.Client
+	Batch      BatchOptions // 分批、缓存与重试
+}
+
+// elasticDoc 一条已编码的日志及其 index
+type elasticDoc struct {
+	index string
+	doc   []byte
+}
+
+// ElasticClient 分批通过 _bulk 写入，429 和 5xx 的条目按指数退避重试，其他失败的条目丢弃
+type ElasticClient struct {
+	opts ElasticOptions
+	url  string
+	b    *batcher[elasticDoc]
+}
+
+// NewElasticClient 创建 _bulk 输出
+func NewElasticClient(opts ElasticOptions) (*ElasticClient, error) {
+	u, err := url.Parse(opts.URL)
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return nil, fmt.Errorf("invalid elasticsearch url %q", opts.URL)
+	}
+	u.Path = strings.TrimRight(u.Path, "/") + "/_bulk"
+	if opts.Index == "" {
+		opts.Index = defaultElasticIndex
+	}
+	if opts.ServiceKey == "" {
+		opts.ServiceKey = "service"
+	}
+	if opts.Client == nil {
+		opts.Client = &http.Client{Timeout: defaultHTTPTimeout}
+	}
+	c := &ElasticClient{opts: opts, url: u.String()}
+	c.b = newBatcher("elasticsearch "+u.Host, opts.Batch, c.bulk, nil)
+	return c, nil
+}
+
+// Sync 立即写入缓存的日志
+func (c *ElasticClient) Sync() error {
+	return c.b.sync()
+}
+
+// Close implements io.Closer. 尝试写入剩余日志后退出
+func (c *ElasticClient) Close() error {
+	return c.b.close()
+}
+
+// Dropped 缓存已满、超过重试次数或被拒绝而丢弃的日志条数
+func (c *ElasticClient) Dropped() uint64 {
+	return c.b.dropped.Load()
+}
+
+// bulk 发送一批，返回需要重试的条目下标
+func (c *ElasticClient) bulk(docs []elasticDoc) ([]int, error) {
+	var body bytes.Buffer
+	for _, d := range docs {
+		action, _ := json.Marshal(map[string]map[string]string{"create": {"_index": d.index}})
+		body.Write(action)
+		body.WriteByte('\n')
+		body.Write(d.doc)
+		body.WriteByte('\n')
+	}
+	req, err := http.NewRequest(http.MethodPost, c.url, &body)
+	if err != nil {
+		return nil, &permanentError{err: err}
+	}
+	for k, v := range c.opts.Header {
+		req.Header[k] = v
+	}
+	req.Header.Set("Content-Type", "application/x-ndjson")
+	if c.opts.Username != "" {
+		req.SetBasicAuth(c.opts.Username, c.opts.Password)
+	}
+	if c.opts.APIKey != "" {
+		req.Header.Set("Authorization", "ApiKey "+c.opts.APIKey)
+	}
+	resp, err := c.opts.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		err := fmt.Errorf("POST %s: %s %s", req.URL.Redacted(), resp.Status, bytes.TrimSpace(msg))
+		if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500 {
+			return nil, err
+		}
+		return nil, &permanentError{err: err}
+	}
+	var result struct {
+		Errors bool `json:"errors"`
+		Items  []map[string]struct {
+			Status int             `json:"status"`
+			Error  json.RawMessage `json:"error"`
+		} `json:"items"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("decode bulk response: %v", err)
+	}
+	if !result.Errors {
+		return nil, nil
+	}
+	// 部分失败: 429 5xx 重试，其他如 mapping 错误丢弃
+	var retry []int
+	var rejected []elasticDoc
+	var firstErr json.RawMessage
+	for i, item := range result.Items {
+		for _, r := range item {
+			switch {
+			case r.Status < 300:
+			case r.Status == http.StatusTooManyRequests || r.Status >= 500:
+				retry = append(retry, i)
+			default:
+				rejected = append(rejected, docs[i])
+				if firstErr == nil {
+					firstErr = r.Error
+				}
+			}
+		}
+	}
+	if len(rejected) > 0 {
+		c.b.reject(rejected, fmt.Errorf("elasticsearch rejected: %s", firstErr))
+	}
+	if len(retry) > 0 {
+		return retry, fmt.Errorf("elasticsearch: %d of %d bulk items need retry", len(retry), len(docs))
+	}
+	return nil, nil
+}
+
+// elasticCore 使用 json 编码器编码日志，按 index 模板计算每条日志的 index
+type elasticCore struct {
+	zapcore.LevelEnabler
+	enc    zapcore.Encoder
+	c      *ElasticClient
+	fields []zapcore.Field
+}
+
+// NewElasticCore 创建 _bulk 输出 core，enc 为空时使用与文件输出一致的 json 编码器(RFC 3339 时间)
+// 返回的 io.Closer 为 *ElasticClient，可通过 Dropped 获取丢弃条数
+func NewElasticCore(opts ElasticOptions, enc zapcore.Encoder) (zapcore.Core, io.Closer, error) {
+	c, err := NewElasticClient(opts)
+	if err != nil {
+		return nil, nil, err
+	}
+	if enc == nil {
+		enc = newEncoder(EncoderOption{formatter: "json", timeFmt: "rfc3339", shortCaller: true})
+	}
+	return &elasticCore{LevelEnabler: zapcore.DebugLevel, enc: enc, c: c}, c, nil
+}
+
+// With implements zapcore.Core.
+func (c *elasticCore) With(fields []zapcore.Field) zapcore.Core {
+	n := *c
+	n.enc = c.enc.Clone()
+	for _, f := range fields {
+		f.AddTo(n.enc)
+	}
+	n.fields = make([]zapcore.Field, 0, len(c.fields)+len(fields))
+	n.fields = append(n.fields, c.fields...)
+	n.fields = append(n.fields, fields...)
+	return &n
+}
+
+// Check implements zapcore.Core.
+func (c *elasticCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(ent.Level) {
+		return ce.AddCore(ent, c)
+	}
+	return ce
+}
+
+// Write implements zapcore.Core.
+func (c *elasticCore) Write(ent zapcore.Entry, fields []zapcore.Field) error {
+	buf, err := c.enc.EncodeEntry(ent, fields)
+	if err != nil {
+		return err
+	}
+	doc := bytes.TrimRight(buf.Bytes(), "\n")
+	d := elasticDoc{index: c.index(ent, fields), doc: append([]byte(nil), doc...)}
+	buf.Free()
+	c.c.b.post(d, len(d.doc)+len(d.index))
+	return nil
+}
+
+// Sync implements zapcore.Core.
+func (c *elasticCore) Sync() error {
+	return c.c.Sync()
+}
+
+// index 展开 index 模板，只格式化 {date} 占位符，其余文本原样保留，结果转小写
+func (c *elasticCore) index(ent zapcore.Entry, fields []zapcore.Field) string {
+	pattern := c.c.opts.Index
+	var b strings.Builder
+	for {
+		start := strings.IndexByte(pattern, '{')
+		end := strings.IndexByte(pattern[start+1:], '}') + start + 1
+		if start < 0 || end <= start {
+			break
+		}
+		b.WriteString(pattern[:start])
+		b.WriteString(c.placeholder(pattern[start+1:end], ent, fields))
+		pattern = pattern[end+1:]
+	}
+	b.WriteString(pattern)
+	return strings.ToLower(b.String())
+}
+
+// placeholder {date} 按 2006.01.02，{date:layout} 按 layout 格式化日志时间，{service} 为 ServiceKey 字段值，其他为同名字段值
+func (c *elasticCore) placeholder(key string, ent zapcore.Entry, fields []zapcore.Field) string {
+	if key == "date" {
+		return ent.Time.Format(defaultElasticDateLayout)
+	}
+	if layout, ok := strings.CutPrefix(key, "date:"); ok {
+		return elasticIndexValue(ent.Time.Format(layout))
+	}
+	if key == "service" {
+		key = c.c.opts.ServiceKey
+	}
+	return elasticIndexValue(lookupField(key, ent, fields, c.fields))
+}
+
+// lookupField 日志字段值，level 为级别，logger 为命名 logger 名称，fields 优先于 With 的 base，后写入的字段优先
+func lookupField(key string, ent zapcore.Entry, fields, base []zapcore.Field) string {
+	switch key {
+	case "level":
+		return ent.Level.String()
+	case "logger":
+		return ent.LoggerName
+	}
+	for _, fs := range [][]zapcore.Field{fields, base} {
+		for i := len(fs) - 1; i >= 0; i-- {
+			if fs[i].Key == key {
+				enc := zapcore.NewMapObjectEncoder()
+				fs[i].AddTo(enc)
+				return fieldString(enc.Fields[key])
+			}
+		}
+	}
+	return ""
+}
+
+// elasticIndexValue index 名不允许 \ / * ? " < > | 空格 , # :
+func elasticIndexValue(s string) string {
+	if s == "" {
+		return "unknown"
+	}
+	return strings.Map(func(r rune) rune {
+		if strings.ContainsRune(`\/*?"<>|, #:`, r) {
+			return '_'
+		}
+		return r
+	}, s)
+}
@@ -0,0 +1,97 @@
+package zlog
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+func TestElasticBulk(t *testing.T) {
+	var mu sync.Mutex
+	var indexed []string
+	var calls int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		calls++
+		if r.URL.Path != "/_bulk" || r.Header.Get("Content-Type") != "application/x-ndjson" {
+			t.Errorf("unexpected request %s %v", r.URL.Path, r.Header)
+		}
+		if user, pass, _ := r.BasicAuth(); user != "elastic" || pass != "secret" {
+			t.Errorf("unexpected auth %s %s", user, pass)
+		}
+		// 第一次: 第一条成功，第二条 429 重试，第三条 mapping 错误丢弃
+		var items []string
+		sc := bufio.NewScanner(r.Body)
+		for i := 0; sc.Scan(); i++ {
+			var action map[string]map[string]string
+			if err := json.Unmarshal(sc.Bytes(), &action); err != nil {
+				t.Errorf("invalid action %s", sc.Text())
+			}
+			sc.Scan()
+			var doc map[string]interface{}
+			if err := json.Unmarshal(sc.Bytes(), &doc); err != nil {
+				t.Errorf("invalid doc %s", sc.Text())
+			}
+			status := 201
+			if calls == 1 && i == 1 {
+				status = 429
+			} else if calls == 1 && i == 2 {
+				status = 400
+			} else {
+				indexed = append(indexed, action["create"]["_index"]+" "+doc["msg"].(string))
+			}
+			items = append(items, fmt.Sprintf(`{"create":{"status":%d,"error":{"type":"e%d"}}}`, status, status))
+		}
+		fmt.Fprintf(w, `{"errors":%v,"items":[%s]}`, calls == 1, strings.Join(items, ","))
+	}))
+	defer srv.Close()
+	logger, err := New(WithService("App"), WithElastic(ElasticOptions{URL: srv.URL, Username: "elastic", Password: "secret",
+		Batch: BatchOptions{BatchSize: 3, FlushInterval: time.Hour, MinBackoff: 10 * time.Millisecond}}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer logger.Close(context.Background())
+	logger.Info("first")
+	logger.Info("second")
+	logger.Info("third")
+
+	for i := 0; i < 100; i++ {
+		mu.Lock()
+		n := len(indexed)
+		mu.Unlock()
+		if n >= 2 {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	index := "logs-app-" + time.Now().Format("2006.01.02")
+	if len(indexed) != 2 || indexed[0] != index+" first" || indexed[1] != index+" second" || calls != 2 {
+		t.Fatalf("unexpected indexed %v after %d calls", indexed, calls)
+	}
+}
+
+func TestElasticIndexPattern(t *testing.T) {
+	core, closer, err := NewElasticCore(ElasticOptions{URL: "http://127.0.0.1:9200", Index: "{team}-{level}-v2-{date:2006.01}-{service}", ServiceKey: "app"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer closer.Close()
+	c := core.With([]zapcore.Field{zap.String("team", "a/b"), zap.String("app", "Pay")}).(*elasticCore)
+	ent := zapcore.Entry{Level: zapcore.ErrorLevel, Time: time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)}
+	if got := c.index(ent, nil); got != "a_b-error-v2-2024.03-pay" {
+		t.Fatalf("unexpected index %q", got)
+	}
+}
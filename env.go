@@ -0,0 +1,76 @@
+// @Author: openownworld
+// @Email:  openownworld@163.com
+// @File:   env.go
+// @Description: 环境变量覆盖 Config
+
+package zlog
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// DefaultEnvPrefix 默认环境变量前缀 ZLOG_LEVEL=warn
+const DefaultEnvPrefix = "ZLOG_"
+
+var (
+	envMtx    sync.RWMutex
+	envPrefix = DefaultEnvPrefix
+)
+
+// SetEnvPrefix 设置环境变量前缀，需在初始化日志前调用，为空表示不读取环境变量
+func SetEnvPrefix(prefix string) {
+	envMtx.Lock()
+	envPrefix = prefix
+	envMtx.Unlock()
+}
+
+// GetEnvPrefix 返回当前环境变量前缀
+func GetEnvPrefix() string {
+	envMtx.RLock()
+	defer envMtx.RUnlock()
+	return envPrefix
+}
+
+// ApplyEnv 使用当前前缀的环境变量覆盖 Config
+// 优先级：GetDefaultConfig < 配置文件 < 环境变量，InitLog 传入的 Config 不会被覆盖
+// 变量名为前缀加 ini tag，大小写、_ 不敏感，ZLOG_LOGFILENAME ZLOG_LOG_FILE_NAME 等价
+// 类型转换失败的变量不生效，返回包含所有错误的 error
+func ApplyEnv(config *Config) error {
+	return ApplyEnvPrefix(config, GetEnvPrefix())
+}
+
+// ApplyEnvPrefix 使用指定前缀的环境变量覆盖 Config
+func ApplyEnvPrefix(config *Config, prefix string) error {
+	if prefix == "" {
+		return nil
+	}
+	fields := configFields()
+	v := reflect.ValueOf(config).Elem()
+	environ := os.Environ()
+	sort.Strings(environ)
+	var errs []error
+	for _, kv := range environ {
+		i := strings.IndexByte(kv, '=')
+		if i < 0 || len(kv[:i]) <= len(prefix) || !strings.EqualFold(kv[:len(prefix)], prefix) {
+			continue
+		}
+		name, value := kv[:i], kv[i+1:]
+		idx, ok := fields[configKey(name[len(prefix):])]
+		if !ok {
+			continue
+		}
+		field := reflect.New(v.Field(idx).Type()).Elem()
+		if err := setConfigField(field, value); err != nil {
+			errs = append(errs, fmt.Errorf("env %s: %v", name, err))
+			continue
+		}
+		v.Field(idx).Set(field)
+	}
+	return errors.Join(errs...)
+}
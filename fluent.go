@@ -0,0 +1,280 @@
+// @Author: openownworld
+// @Email:  openownworld@163.com
+// @File:   fluent.go
+// @Description: Fluentd / Fluent Bit forward 协议输出，PackedForward 批量发送，可选 ack，断线缓存重试
+
+package zlog
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/vmihailenco/msgpack/v5"
+	"go.uber.org/zap/zapcore"
+)
+
+const (
+	defaultFluentBatchSize  = 100
+	defaultFluentAckTimeout = 5 * time.Second
+)
+
+// FluentOptions forward 协议输出选项
+type FluentOptions struct {
+	Network    string        // tcp tls unix，默认 tcp
+	Addr       string        // forward input 地址 127.0.0.1:24224，unix 为 socket 路径
+	Tag        string        // tag，默认 zlog
+	RequireAck bool          // 每批带 chunk id 并等待服务端 ack，超时按失败重试
+	AckTimeout time.Duration // 等待 ack 的超时，默认 5s
+	TLS        *tls.Config   // tls 连接配置，为空时使用系统根证书
+	Batch      BatchOptions  // 分批、缓存与重试，BatchSize 为每个 PackedForward 消息的条数，默认 100，BufferSize 默认 1000
+}
+
+// FluentForwarder 缓存编码后的日志，后台按批发送，失败时保留并按指数退避重试
+type FluentForwarder struct {
+	opts FluentOptions
+	dial func() (net.Conn, error)
+	conn net.Conn // 只在 batcher 的发送 goroutine 中使用
+	b    *batcher[[]byte]
+}
+
+// NewFluentForwarder 创建 forward 协议输出，连接失败时在发送时重试
+func NewFluentForwarder(opts FluentOptions) (*FluentForwarder, error) {
+	if opts.Addr == "" {
+		return nil, errors.New("fluent addr is required")
+	}
+	if opts.Tag == "" {
+		opts.Tag = "zlog"
+	}
+	if opts.AckTimeout <= 0 {
+		opts.AckTimeout = defaultFluentAckTimeout
+	}
+	if opts.Batch.BatchSize <= 0 {
+		opts.Batch.BatchSize = defaultFluentBatchSize
+	}
+	if opts.Batch.BufferSize <= 0 {
+		opts.Batch.BufferSize = defaultSocketBufferSize
+	}
+	f := &FluentForwarder{opts: opts}
+	switch strings.ToLower(opts.Network) {
+	case "", "tcp", "unix":
+		network := strings.ToLower(opts.Network)
+		if network == "" {
+			network = "tcp"
+		}
+		f.dial = func() (net.Conn, error) {
+			return net.DialTimeout(network, opts.Addr, socketDialTimeout)
+		}
+	case "tls":
+		c := opts.TLS
+		if c == nil {
+			c = &tls.Config{MinVersion: tls.VersionTLS12}
+		}
+		if c.ServerName == "" {
+			c = c.Clone()
+			if host, _, err := net.SplitHostPort(opts.Addr); err == nil {
+				c.ServerName = host
+			}
+		}
+		f.dial = func() (net.Conn, error) {
+			return tls.DialWithDialer(&net.Dialer{Timeout: socketDialTimeout}, "tcp", opts.Addr, c)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported fluent network %q", opts.Network)
+	}
+	if conn, err := f.dial(); err == nil {
+		f.conn = conn
+	}
+	f.b = newBatcher("fluent "+opts.Addr, opts.Batch, func(batch [][]byte) ([]int, error) {
+		return nil, f.send(batch)
+	}, nil)
+	return f, nil
+}
+
+// Post 加入一条 msgpack 编码的 [time, record]，满一批时通知发送
+func (f *FluentForwarder) Post(entry []byte) {
+	f.b.post(entry, len(entry))
+}
+
+// Sync implements zapcore.WriteSyncer. 立即发送缓存的日志，失败时返回 error 并保留日志等待重试
+func (f *FluentForwarder) Sync() error {
+	return f.b.sync()
+}
+
+// Close implements io.Closer. 尝试发送剩余日志后关闭连接，发送失败的日志被丢弃
+func (f *FluentForwarder) Close() error {
+	err := f.b.close()
+	// batcher 已退出，不再使用 conn
+	if f.conn != nil {
+		_ = f.conn.Close()
+		f.conn = nil
+	}
+	return err
+}
+
+// Dropped 缓存已满、超过重试次数或关闭时丢弃的日志条数
+func (f *FluentForwarder) Dropped() uint64 {
+	return f.b.dropped.Load()
+}
+
+// send 发送 PackedForward 消息 [tag, entries, {size, chunk}]，需要 ack 时等待 {ack: chunk}
+func (f *FluentForwarder) send(batch [][]byte) error {
+	if f.conn == nil {
+		conn, err := f.dial()
+		if err != nil {
+			return err
+		}
+		f.conn = conn
+	}
+	option := map[string]interface{}{"size": len(batch)}
+	var chunk string
+	if f.opts.RequireAck {
+		id := make([]byte, 16)
+		_, _ = rand.Read(id)
+		chunk = base64.StdEncoding.EncodeToString(id)
+		option["chunk"] = chunk
+	}
+	var b bytes.Buffer
+	enc := msgpack.NewEncoder(&b)
+	_ = enc.EncodeArrayLen(3)
+	_ = enc.EncodeString(f.opts.Tag)
+	_ = enc.EncodeBytes(bytes.Join(batch, nil))
+	if err := enc.Encode(option); err != nil {
+		return err
+	}
+	err := f.exchange(b.Bytes(), chunk)
+	if err != nil {
+		_ = f.conn.Close()
+		f.conn = nil
+	}
+	return err
+}
+
+func (f *FluentForwarder) exchange(msg []byte, chunk string) error {
+	_ = f.conn.SetWriteDeadline(time.Now().Add(socketWriteTimeout))
+	if _, err := f.conn.Write(msg); err != nil {
+		return err
+	}
+	if chunk == "" {
+		return nil
+	}
+	_ = f.conn.SetReadDeadline(time.Now().Add(f.opts.AckTimeout))
+	var resp struct {
+		Ack string `msgpack:"ack"`
+	}
+	if err := msgpack.NewDecoder(f.conn).Decode(&resp); err != nil {
+		return fmt.Errorf("fluent ack: %v", err)
+	}
+	if resp.Ack != chunk {
+		return fmt.Errorf("fluent ack: unexpected chunk %q, want %q", resp.Ack, chunk)
+	}
+	return nil
+}
+
+// fluentCore 每条日志编码为 [EventTime, record]，record 的键与 json 编码一致
+type fluentCore struct {
+	zapcore.LevelEnabler
+	f      *FluentForwarder
+	fields []zapcore.Field
+}
+
+// NewFluentCore 创建 forward 协议输出 core，返回的 io.Closer 用于发送剩余日志并关闭连接
+func NewFluentCore(opts FluentOptions) (zapcore.Core, io.Closer, error) {
+	f, err := NewFluentForwarder(opts)
+	if err != nil {
+		return nil, nil, err
+	}
+	return &fluentCore{LevelEnabler: zapcore.DebugLevel, f: f}, f, nil
+}
+
+// With implements zapcore.Core.
+func (c *fluentCore) With(fields []zapcore.Field) zapcore.Core {
+	n := *c
+	n.fields = make([]zapcore.Field, 0, len(c.fields)+len(fields))
+	n.fields = append(n.fields, c.fields...)
+	n.fields = append(n.fields, fields...)
+	return &n
+}
+
+// Check implements zapcore.Core.
+func (c *fluentCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(ent.Level) {
+		return ce.AddCore(ent, c)
+	}
+	return ce
+}
+
+// Write implements zapcore.Core.
+func (c *fluentCore) Write(ent zapcore.Entry, fields []zapcore.Field) error {
+	enc := zapcore.NewMapObjectEncoder()
+	for _, f := range c.fields {
+		f.AddTo(enc)
+	}
+	for _, f := range fields {
+		f.AddTo(enc)
+	}
+	record := enc.Fields
+	record["msg"] = ent.Message
+	record["level"] = ent.Level.String()
+	if ent.LoggerName != "" {
+		record["name"] = ent.LoggerName
+	}
+	if ent.Caller.Defined {
+		record["caller"] = ent.Caller.TrimmedPath()
+		if ent.Caller.Function != "" {
+			record["func"] = ent.Caller.Function
+		}
+	}
+	if ent.Stack != "" {
+		record["stack"] = ent.Stack
+	}
+	// [EventTime, record]，EventTime 为 ext type 0: 秒 纳秒 各 32 位大端
+	var b bytes.Buffer
+	b.Write([]byte{0x92, 0xd7, 0x00})
+	_ = binary.Write(&b, binary.BigEndian, uint32(ent.Time.Unix()))
+	_ = binary.Write(&b, binary.BigEndian, uint32(ent.Time.Nanosecond()))
+	if err := msgpack.NewEncoder(&b).Encode(record); err != nil {
+		return err
+	}
+	c.f.Post(b.Bytes())
+	return nil
+}
+
+// Sync implements zapcore.Core.
+func (c *fluentCore) Sync() error {
+	return c.f.Sync()
+}
+
+// newConfigFluentCore 按 Config 创建 forward 输出，tag 默认 serviceName，tls 使用 socketTLS* 证书配置
+func newConfigFluentCore(logConfig Config) (zapcore.Core, io.Closer, error) {
+	opts := FluentOptions{
+		Network:    logConfig.FluentNetwork,
+		Addr:       logConfig.FluentAddr,
+		Tag:        logConfig.FluentTag,
+		RequireAck: logConfig.FluentRequireAck,
+		Batch:      BatchOptions{BufferSize: logConfig.SocketBufferSize},
+	}
+	if opts.Tag == "" {
+		opts.Tag = logConfig.ServiceName
+	}
+	if strings.EqualFold(opts.Network, "tls") {
+		c, err := configTLS(logConfig)
+		if err != nil {
+			return nil, nil, fmt.Errorf("fluent: %v", err)
+		}
+		opts.TLS = c
+	}
+	c, closer, err := NewFluentCore(opts)
+	if err != nil {
+		return nil, nil, fmt.Errorf("fluent: %v", err)
+	}
+	return c, closer, nil
+}
@@ -0,0 +1,121 @@
+package zlog
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+type fluentEvent struct {
+	tag    string
+	time   time.Time
+	record map[string]interface{}
+}
+
+// readFluent 读取一个 PackedForward 消息，有 chunk 时回复 ack
+func readFluent(t *testing.T, conn net.Conn, dec *msgpack.Decoder) []fluentEvent {
+	_ = conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	if n, err := dec.DecodeArrayLen(); err != nil || n != 3 {
+		t.Fatalf("unexpected message: %d %v", n, err)
+	}
+	tag, err := dec.DecodeString()
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries, err := dec.DecodeBytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	option, err := dec.DecodeMap()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var events []fluentEvent
+	ed := msgpack.NewDecoder(bytes.NewReader(entries))
+	for {
+		if _, err := ed.DecodeArrayLen(); err != nil {
+			break
+		}
+		id, n, err := ed.DecodeExtHeader()
+		if err != nil || id != 0 || n != 8 {
+			t.Fatalf("unexpected EventTime: %d %d %v", id, n, err)
+		}
+		b := make([]byte, 8)
+		if err := ed.ReadFull(b); err != nil {
+			t.Fatal(err)
+		}
+		record, err := ed.DecodeMap()
+		if err != nil {
+			t.Fatal(err)
+		}
+		ts := time.Unix(int64(binary.BigEndian.Uint32(b)), int64(binary.BigEndian.Uint32(b[4:])))
+		events = append(events, fluentEvent{tag: tag, time: ts, record: record})
+	}
+	if size, _ := option["size"].(int8); int(size) != len(events) {
+		t.Fatalf("option size %v, got %d events", option["size"], len(events))
+	}
+	if chunk, ok := option["chunk"].(string); ok {
+		if err := msgpack.NewEncoder(conn).Encode(map[string]string{"ack": chunk}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return events
+}
+
+func TestFluentForward(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	logger, err := New(WithService("app"), WithFluent(FluentOptions{Addr: ln.Addr().String(), RequireAck: true,
+		Batch: BatchOptions{BatchSize: 2, FlushInterval: time.Hour, MinBackoff: 10 * time.Millisecond, MaxBackoff: 20 * time.Millisecond}}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer logger.Close(context.Background())
+	conn, err := ln.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now()
+	logger.WithField("uid", 7).Info("first")
+	logger.Warn("second")
+	events := readFluent(t, conn, msgpack.NewDecoder(conn))
+	if len(events) != 2 || events[0].tag != "app" {
+		t.Fatalf("unexpected events %v", events)
+	}
+	r := events[0].record
+	if r["msg"] != "first" || r["level"] != "info" || r["service"] != "app" || fmt.Sprint(r["uid"]) != "7" || r["caller"] == nil {
+		t.Fatalf("unexpected record %v", r)
+	}
+	if d := events[0].time.Sub(start); d < 0 || d > time.Second {
+		t.Fatalf("unexpected event time %v", events[0].time)
+	}
+
+	// 断线期间缓存，重连后重试发送
+	conn.Close()
+	logger.Info("third")
+	logger.Info("fourth")
+	conn, err = ln.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	dec := msgpack.NewDecoder(conn)
+	var got []string
+	for len(got) < 2 {
+		for _, e := range readFluent(t, conn, dec) {
+			got = append(got, e.record["msg"].(string))
+		}
+	}
+	if got[0] != "third" || got[1] != "fourth" {
+		t.Fatalf("unexpected messages after reconnect %v", got)
+	}
+}
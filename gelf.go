@@ -0,0 +1,256 @@
+// @Author: openownworld
+// @Email:  openownworld@163.com
+// @File:   gelf.go
+// @Description: GELF 1.1 输出，udp 压缩分片，tcp tls 以 \0 分帧
+
+package zlog
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"os"
+	"strings"
+
+	"go.uber.org/zap/buffer"
+	"go.uber.org/zap/zapcore"
+)
+
+// Enums GELF compression constants.
+const (
+	GELFCompressNone = "none"
+	GELFCompressGzip = "gzip"
+	GELFCompressZlib = "zlib"
+)
+
+const (
+	defaultGELFChunkSize = 1420 // 广域网安全的 udp 报文大小，局域网可用 8154
+	gelfChunkHeader      = 12   // 0x1e 0x0f + 8 字节消息 id + 序号 + 分片数
+	gelfMaxChunks        = 128
+)
+
+var gelfPool = buffer.NewPool()
+
+// GELFOptions GELF 输出选项
+type GELFOptions struct {
+	Network     string        // udp tcp tls，默认 udp
+	Addr        string        // Graylog GELF input 地址
+	Compression string        // udp 压缩 gzip zlib none，默认 gzip，tcp tls 不压缩
+	ChunkSize   int           // udp 单个报文大小，超过时分片，默认 1420
+	Host        string        // host 字段，默认 os.Hostname
+	Stream      StreamOptions // tcp tls 的重连、缓存与 tls 配置
+}
+
+// gelfEncoder 按 GELF 1.1 编码日志，msg level caller stack 对应 short_message level _file full_message
+// 其他字段加 _ 前缀作为附加字段
+type gelfEncoder struct {
+	*zapcore.MapObjectEncoder
+	host string
+}
+
+// NewGELFEncoder 创建 GELF 1.1 编码器，可配合自定义 WriteSyncer 使用
+func NewGELFEncoder(host string) zapcore.Encoder {
+	if host == "" {
+		host, _ = os.Hostname()
+	}
+	return &gelfEncoder{MapObjectEncoder: zapcore.NewMapObjectEncoder(), host: host}
+}
+
+// Clone implements zapcore.Encoder.
+func (e *gelfEncoder) Clone() zapcore.Encoder {
+	c := zapcore.NewMapObjectEncoder()
+	for k, v := range e.Fields {
+		c.Fields[k] = v
+	}
+	return &gelfEncoder{MapObjectEncoder: c, host: e.host}
+}
+
+// EncodeEntry implements zapcore.Encoder.
+func (e *gelfEncoder) EncodeEntry(ent zapcore.Entry, fields []zapcore.Field) (*buffer.Buffer, error) {
+	enc := e.Clone().(*gelfEncoder)
+	for _, f := range fields {
+		f.AddTo(enc)
+	}
+	m := make(map[string]interface{}, len(enc.Fields)+8)
+	for k, v := range enc.Fields {
+		m[gelfName(k)] = gelfValue(v)
+	}
+	m["version"] = "1.1"
+	m["host"] = e.host
+	m["short_message"] = ent.Message
+	m["timestamp"] = json.Number(fmt.Sprintf("%d.%03d", ent.Time.Unix(), ent.Time.Nanosecond()/1e6))
+	m["level"] = syslogSeverities[ent.Level]
+	if ent.LoggerName != "" {
+		m["_logger"] = ent.LoggerName
+	}
+	if ent.Caller.Defined {
+		m["_file"] = ent.Caller.File
+		m["_line"] = ent.Caller.Line
+		if ent.Caller.Function != "" {
+			m["_function"] = ent.Caller.Function
+		}
+	}
+	if ent.Stack != "" {
+		m["full_message"] = ent.Message + "\n" + ent.Stack
+	}
+	b, err := json.Marshal(m)
+	if err != nil {
+		return nil, err
+	}
+	buf := gelfPool.Get()
+	buf.Write(b)
+	return buf, nil
+}
+
+// gelfName 附加字段名只允许字母 数字 _ . -，_id 为保留字段
+func gelfName(key string) string {
+	name := strings.Map(func(r rune) rune {
+		if r == '_' || r == '.' || r == '-' || r >= '0' && r <= '9' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' {
+			return r
+		}
+		return '_'
+	}, key)
+	if name == "id" {
+		name = "id_"
+	}
+	return "_" + name
+}
+
+// gelfValue 附加字段值只能是字符串或数字
+func gelfValue(v interface{}) interface{} {
+	switch v.(type) {
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64, float32, float64:
+		return v
+	default:
+		return fieldString(v)
+	}
+}
+
+// GELFWriter udp 发送 GELF 消息，压缩后超过 ChunkSize 时分片发送
+type GELFWriter struct {
+	*DatagramWriter
+	compression string
+	chunkSize   int
+}
+
+// NewGELFWriter 创建 GELF udp 输出，compression 为 gzip zlib none
+func NewGELFWriter(addr, compression string, chunkSize int) (*GELFWriter, error) {
+	switch compression {
+	case "":
+		compression = GELFCompressGzip
+	case GELFCompressGzip, GELFCompressZlib, GELFCompressNone:
+	default:
+		return nil, fmt.Errorf("unknown gelf compression %q, want gzip, zlib or none", compression)
+	}
+	if chunkSize <= gelfChunkHeader {
+		chunkSize = defaultGELFChunkSize
+	}
+	return &GELFWriter{DatagramWriter: NewDatagramWriter("udp", addr), compression: compression, chunkSize: chunkSize}, nil
+}
+
+// Write implements io.Writer. p 为一条完整的 GELF 消息
+func (w *GELFWriter) Write(p []byte) (int, error) {
+	data, err := w.compress(p)
+	if err != nil {
+		return 0, err
+	}
+	if len(data) <= w.chunkSize {
+		_, _ = w.DatagramWriter.Write(data)
+		return len(p), nil
+	}
+	size := w.chunkSize - gelfChunkHeader
+	count := (len(data) + size - 1) / size
+	if count > gelfMaxChunks {
+		w.dropped.Add(1)
+		return len(p), fmt.Errorf("gelf message too large: %d bytes in %d chunks, max %d chunks", len(data), count, gelfMaxChunks)
+	}
+	var id [8]byte
+	binary.BigEndian.PutUint64(id[:], rand.Uint64())
+	chunk := make([]byte, 0, w.chunkSize)
+	for i := 0; i < count; i++ {
+		end := min((i+1)*size, len(data))
+		chunk = append(chunk[:0], 0x1e, 0x0f)
+		chunk = append(chunk, id[:]...)
+		chunk = append(chunk, byte(i), byte(count))
+		chunk = append(chunk, data[i*size:end]...)
+		_, _ = w.DatagramWriter.Write(chunk)
+	}
+	return len(p), nil
+}
+
+func (w *GELFWriter) compress(p []byte) ([]byte, error) {
+	var b bytes.Buffer
+	var zw io.WriteCloser
+	switch w.compression {
+	case GELFCompressGzip:
+		zw = gzip.NewWriter(&b)
+	case GELFCompressZlib:
+		zw = zlib.NewWriter(&b)
+	default:
+		return p, nil
+	}
+	if _, err := zw.Write(p); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+// NewGELFCore 创建 GELF 输出 core，返回的 io.Closer 用于关闭连接
+func NewGELFCore(opts GELFOptions) (zapcore.Core, io.Closer, error) {
+	if opts.Addr == "" {
+		return nil, nil, fmt.Errorf("gelf addr is required")
+	}
+	var w io.WriteCloser
+	switch strings.ToLower(opts.Network) {
+	case "", "udp":
+		gw, err := NewGELFWriter(opts.Addr, strings.ToLower(opts.Compression), opts.ChunkSize)
+		if err != nil {
+			return nil, nil, err
+		}
+		w = gw
+	case "tcp", "tls":
+		// GELF tcp 不支持压缩，每条消息以 \0 结尾
+		if c := strings.ToLower(opts.Compression); c != "" && c != GELFCompressNone {
+			return nil, nil, fmt.Errorf("gelf compression %q is not supported over %s", opts.Compression, opts.Network)
+		}
+		opts.Stream.Framing = FramingNull
+		if strings.EqualFold(opts.Network, "tcp") {
+			w = NewStreamWriter("tcp", opts.Addr, opts.Stream)
+		} else {
+			w = NewTLSWriter(opts.Addr, opts.Stream)
+		}
+	default:
+		return nil, nil, fmt.Errorf("unsupported gelf network %q", opts.Network)
+	}
+	return zapcore.NewCore(NewGELFEncoder(opts.Host), zapcore.AddSync(w), zapcore.DebugLevel), w, nil
+}
+
+// newConfigGELFCore 按 Config 创建 GELF 输出，tls 使用 socketTLS* 证书配置
+func newConfigGELFCore(logConfig Config) (zapcore.Core, io.Closer, error) {
+	opts := GELFOptions{
+		Network:     logConfig.GELFNetwork,
+		Addr:        logConfig.GELFAddr,
+		Compression: logConfig.GELFCompression,
+		Stream:      StreamOptions{BufferSize: logConfig.SocketBufferSize},
+	}
+	if strings.EqualFold(opts.Network, "tls") {
+		c, err := configTLS(logConfig)
+		if err != nil {
+			return nil, nil, fmt.Errorf("gelf: %v", err)
+		}
+		opts.Stream.TLS = c
+	}
+	c, closer, err := NewGELFCore(opts)
+	if err != nil {
+		return nil, nil, fmt.Errorf("gelf: %v", err)
+	}
+	return c, closer, nil
+}
@@ -0,0 +1,117 @@
+package zlog
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestGELFUDPChunked(t *testing.T) {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pc.Close()
+	logger, err := New(WithService("app"), WithGELF(GELFOptions{Addr: pc.LocalAddr().String(), ChunkSize: 64, Host: "host"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer logger.Close(context.Background())
+	logger.WithFields(map[string]interface{}{"id": 1, "ok": true}).Error(strings.Repeat("big message ", 20))
+
+	// 按序号拼接分片
+	var chunks [][]byte
+	buf := make([]byte, 2048)
+	for count := 1; len(chunks) < count; {
+		_ = pc.SetReadDeadline(time.Now().Add(time.Second))
+		n, _, err := pc.ReadFrom(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n > 64 || buf[0] != 0x1e || buf[1] != 0x0f {
+			t.Fatalf("unexpected chunk %q", buf[:n])
+		}
+		count = int(buf[11])
+		if chunks == nil {
+			chunks = make([][]byte, 0, count)
+		}
+		if int(buf[10]) != len(chunks) {
+			t.Fatalf("unexpected chunk sequence %d", buf[10])
+		}
+		chunks = append(chunks, append([]byte(nil), buf[12:n]...))
+	}
+	if len(chunks) < 2 {
+		t.Fatalf("expect chunked message, got %d chunks", len(chunks))
+	}
+	zr, err := gzip.NewReader(bytes.NewReader(bytes.Join(chunks, nil)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := io.ReadAll(zr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var m map[string]interface{}
+	if err := json.Unmarshal(data, &m); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]interface{}{
+		"version": "1.1", "host": "host", "short_message": strings.Repeat("big message ", 20),
+		"level": float64(3), "_service": "app", "_id_": float64(1), "_ok": "true",
+	}
+	for k, v := range want {
+		if m[k] != v {
+			t.Fatalf("field %s = %v, want %v in %s", k, m[k], v, data)
+		}
+	}
+	if file, _ := m["_file"].(string); !strings.HasSuffix(file, "gelf_test.go") {
+		t.Fatalf("unexpected _file in %s", data)
+	}
+}
+
+func TestGELFTCP(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	logger, err := New(WithGELF(GELFOptions{Network: "tcp", Addr: ln.Addr().String()}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer logger.Close(context.Background())
+	conn, err := ln.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	logger.Info("first")
+	logger.Info("second")
+
+	r := bufio.NewReader(conn)
+	for _, msg := range []string{"first", "second"} {
+		_ = conn.SetReadDeadline(time.Now().Add(time.Second))
+		frame, err := r.ReadBytes(0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var m map[string]interface{}
+		if err := json.Unmarshal(frame[:len(frame)-1], &m); err != nil {
+			t.Fatalf("%v: %q", err, frame)
+		}
+		if m["short_message"] != msg || m["level"] != float64(6) {
+			t.Fatalf("unexpected message %q", frame)
+		}
+	}
+
+	if _, err := New(WithGELF(GELFOptions{Network: "tcp", Addr: ln.Addr().String(), Compression: "gzip"})); err == nil {
+		t.Fatal("expect error for compression over tcp")
+	}
+}
@@ -3,9 +3,18 @@ module github.com/openownworld/zlog
 go 1.25.3
 
 require (
+	github.com/BurntSushi/toml v1.5.0
 	github.com/go-ini/ini v1.67.0
+	github.com/golang/snappy v1.0.0
+	github.com/vmihailenco/msgpack/v5 v5.4.1
 	go.uber.org/zap v1.27.0
+	golang.org/x/sys v0.38.0
+	google.golang.org/protobuf v1.36.11
 	gopkg.in/natefinch/lumberjack.v2 v2.2.1
+	gopkg.in/yaml.v3 v3.0.1
 )
 
-require go.uber.org/multierr v1.11.0 // indirect
+require (
+	github.com/vmihailenco/tagparser/v2 v2.0.0 // indirect
+	go.uber.org/multierr v1.11.0 // indirect
+)
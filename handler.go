@@ -0,0 +1,212 @@
+// @Author: openownworld
+// @Email:  openownworld@163.com
+// @File:   handler.go
+// @Description: HTTP 动态查看、修改日志级别
+
+package zlog
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// levelRequest PUT/POST 请求体，name 为空表示默认 logger，ttl 到期后自动恢复
+type levelRequest struct {
+	Name  string `json:"name"`
+	Level string `json:"level"`
+	TTL   string `json:"ttl"`
+}
+
+// levelResponse GET 返回默认 logger 与所有命名 logger 的当前级别
+type levelResponse struct {
+	Level     string            `json:"level"`
+	Loggers   map[string]string `json:"loggers"`
+	Overrides map[string]string `json:"overrides"`
+	Reverts   map[string]string `json:"reverts,omitempty"`
+}
+
+type levelErrorResponse struct {
+	Error string `json:"error"`
+}
+
+// levelRevert 带 ttl 的临时修改，restore 恢复到第一次临时修改前的状态
+type levelRevert struct {
+	timer   *time.Timer
+	at      time.Time
+	restore func()
+}
+
+var (
+	revertMtx sync.Mutex
+	reverts   = map[string]*levelRevert{}
+)
+
+// LevelHandler returns an http.Handler for viewing and changing log levels at runtime.
+//
+//	GET                                             查看默认 logger 及所有命名 logger 级别
+//	PUT/POST {"level":"warn"}                       修改默认 logger 级别
+//	PUT/POST {"name":"payments","level":"debug","ttl":"10m"} 修改前缀级别，10 分钟后恢复
+//	DELETE   ?name=payments                         删除前缀级别覆盖
+//
+// PUT/POST 也支持 query 参数 name、level、ttl。
+func LevelHandler() http.Handler {
+	return http.HandlerFunc(serveLevel)
+}
+
+func serveLevel(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPut, http.MethodPost:
+		req, err := decodeLevelRequest(r)
+		if err != nil {
+			writeLevelJSON(w, http.StatusBadRequest, levelErrorResponse{Error: err.Error()})
+			return
+		}
+		if err := applyLevelRequest(req); err != nil {
+			writeLevelJSON(w, http.StatusBadRequest, levelErrorResponse{Error: err.Error()})
+			return
+		}
+	case http.MethodDelete:
+		name := r.URL.Query().Get("name")
+		if name == "" {
+			writeLevelJSON(w, http.StatusBadRequest, levelErrorResponse{Error: "name is required"})
+			return
+		}
+		cancelRevert(name)
+		ResetNamedLevel(name)
+	default:
+		w.Header().Set("Allow", "GET, PUT, POST, DELETE")
+		writeLevelJSON(w, http.StatusMethodNotAllowed, levelErrorResponse{Error: "method not allowed"})
+		return
+	}
+	writeLevelJSON(w, http.StatusOK, currentLevels())
+}
+
+func decodeLevelRequest(r *http.Request) (levelRequest, error) {
+	var req levelRequest
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") || r.ContentLength > 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			return req, fmt.Errorf("decode request body failed: %v", err)
+		}
+	}
+	q := r.URL.Query()
+	if v := q.Get("name"); v != "" {
+		req.Name = v
+	}
+	if v := q.Get("level"); v != "" {
+		req.Level = v
+	}
+	if v := q.Get("ttl"); v != "" {
+		req.TTL = v
+	}
+	return req, nil
+}
+
+func applyLevelRequest(req levelRequest) error {
+	level, ok := LevelNames[strings.ToLower(req.Level)]
+	if !ok {
+		return fmt.Errorf("unknown level %q", req.Level)
+	}
+	var ttl time.Duration
+	if req.TTL != "" {
+		d, err := time.ParseDuration(req.TTL)
+		if err != nil || d <= 0 {
+			return fmt.Errorf("invalid ttl %q", req.TTL)
+		}
+		ttl = d
+	}
+	var apply, restore func()
+	if req.Name == "" {
+		// ttl 到期前默认 logger 可能已被 InitLog 替换，恢复时重新获取
+		prev := GetDefaultLogger().GetLevel()
+		apply = func() { GetDefaultLogger().SetLevel(level) }
+		restore = func() { GetDefaultLogger().SetLevel(prev) }
+	} else {
+		prev, had := NamedLevels()[req.Name]
+		apply = func() { SetNamedLevel(req.Name, level) }
+		restore = func() {
+			if had {
+				SetNamedLevel(req.Name, prev)
+			} else {
+				ResetNamedLevel(req.Name)
+			}
+		}
+	}
+	setWithRevert(req.Name, apply, restore, ttl)
+	return nil
+}
+
+// setWithRevert 修改级别，ttl > 0 时到期恢复；重复临时修改保留最初的恢复目标
+func setWithRevert(key string, apply, restore func(), ttl time.Duration) {
+	revertMtx.Lock()
+	defer revertMtx.Unlock()
+	if p, ok := reverts[key]; ok {
+		p.timer.Stop()
+		restore = p.restore
+		delete(reverts, key)
+	}
+	apply()
+	if ttl <= 0 {
+		return
+	}
+	rv := &levelRevert{at: time.Now().Add(ttl), restore: restore}
+	rv.timer = time.AfterFunc(ttl, func() {
+		revertMtx.Lock()
+		defer revertMtx.Unlock()
+		if reverts[key] != rv {
+			return
+		}
+		delete(reverts, key)
+		rv.restore()
+	})
+	reverts[key] = rv
+}
+
+func cancelRevert(key string) {
+	revertMtx.Lock()
+	if p, ok := reverts[key]; ok {
+		p.timer.Stop()
+		delete(reverts, key)
+	}
+	revertMtx.Unlock()
+}
+
+func currentLevels() levelResponse {
+	logger := GetDefaultLogger()
+	level := logger.GetLevel()
+	resp := levelResponse{
+		Level:     level.String(),
+		Loggers:   map[string]string{},
+		Overrides: map[string]string{},
+	}
+	levels := defaultLevels()
+	for _, name := range LoggerNames() {
+		lvl := level
+		if v, ok := levels.resolve(name); ok {
+			lvl = zapLevelToLevel[v]
+		}
+		resp.Loggers[name] = lvl.String()
+	}
+	for prefix, lvl := range NamedLevels() {
+		resp.Overrides[prefix] = lvl.String()
+	}
+	revertMtx.Lock()
+	if len(reverts) > 0 {
+		resp.Reverts = map[string]string{}
+		for key, rv := range reverts {
+			resp.Reverts[key] = rv.at.Format(time.RFC3339)
+		}
+	}
+	revertMtx.Unlock()
+	return resp
+}
+
+func writeLevelJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(v)
+}
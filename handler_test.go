@@ -0,0 +1,64 @@
+package zlog
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLevelHandler(t *testing.T) {
+	cfg := GetDefaultConfig()
+	cfg.FileLogger = false
+	InitLog(cfg)
+	Named("handler.test")
+	srv := httptest.NewServer(LevelHandler())
+	defer srv.Close()
+	do := func(method, url, body string) (int, levelResponse) {
+		req, _ := http.NewRequest(method, srv.URL+url, strings.NewReader(body))
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		var v levelResponse
+		_ = json.NewDecoder(resp.Body).Decode(&v)
+		return resp.StatusCode, v
+	}
+	code, v := do(http.MethodPut, "", `{"level":"warn"}`)
+	if code != http.StatusOK || v.Level != "warn" || GetLevel() != LevelWarn {
+		t.Fatalf("put default: %d %+v", code, v)
+	}
+	code, v = do(http.MethodPost, "?name=handler&level=error&ttl=50ms", "")
+	if code != http.StatusOK || v.Loggers["handler.test"] != "error" || v.Reverts["handler"] == "" {
+		t.Fatalf("post named: %d %+v", code, v)
+	}
+	time.Sleep(200 * time.Millisecond)
+	code, v = do(http.MethodGet, "", "")
+	if code != http.StatusOK || v.Loggers["handler.test"] != "warn" || len(v.Overrides) != 0 {
+		t.Fatalf("ttl revert: %d %+v", code, v)
+	}
+	if code, _ = do(http.MethodPut, "", `{"level":"verbose"}`); code != http.StatusBadRequest {
+		t.Fatalf("bad level: %d", code)
+	}
+	SetLevel(LevelDebug)
+}
+
+func TestLevelHandlerRevertAfterReplace(t *testing.T) {
+	cfg := GetDefaultConfig()
+	cfg.FileLogger = false
+	cfg.Level = "info"
+	InitLog(cfg)
+	defer InitLog(GetDefaultConfig())
+	if err := applyLevelRequest(levelRequest{Level: "error", TTL: "50ms"}); err != nil {
+		t.Fatal(err)
+	}
+	cfg.Level = "error"
+	InitLog(cfg)
+	time.Sleep(200 * time.Millisecond)
+	if GetLevel() != LevelInfo {
+		t.Fatalf("level %v after ttl, want info", GetLevel())
+	}
+}
@@ -0,0 +1,156 @@
+// @Author: openownworld
+// @Email:  openownworld@163.com
+// @File:   journald.go
+// @Description: systemd-journald 输出，native journal 协议，字段写入 journal 字段
+
+package zlog
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"go.uber.org/zap/zapcore"
+)
+
+const defaultJournalAddr = "/run/systemd/journal/socket"
+
+// JournalOptions journald 输出选项
+type JournalOptions struct {
+	Addr             string // journald socket，默认 /run/systemd/journal/socket
+	SyslogIdentifier string // SYSLOG_IDENTIFIER，默认进程名
+}
+
+// journalCore 每条日志编码为一个 journal entry，zap 字段名转大写作为 journal 字段
+type journalCore struct {
+	zapcore.LevelEnabler
+	identifier string
+	w          io.Writer
+	fields     []zapcore.Field
+}
+
+// NewJournalCore 创建 journald 输出 core，返回的 io.Closer 用于关闭 socket
+// 只支持 linux，entry 超过 socket 单个报文上限时通过 memfd 传递
+func NewJournalCore(opts JournalOptions) (zapcore.Core, io.Closer, error) {
+	if opts.Addr == "" {
+		opts.Addr = defaultJournalAddr
+	}
+	if opts.SyslogIdentifier == "" {
+		opts.SyslogIdentifier = filepath.Base(os.Args[0])
+	}
+	w, err := newJournalWriter(opts.Addr)
+	if err != nil {
+		return nil, nil, err
+	}
+	return &journalCore{LevelEnabler: zapcore.DebugLevel, identifier: opts.SyslogIdentifier, w: w}, w, nil
+}
+
+// With implements zapcore.Core.
+func (c *journalCore) With(fields []zapcore.Field) zapcore.Core {
+	n := *c
+	n.fields = make([]zapcore.Field, 0, len(c.fields)+len(fields))
+	n.fields = append(n.fields, c.fields...)
+	n.fields = append(n.fields, fields...)
+	return &n
+}
+
+// Check implements zapcore.Core.
+func (c *journalCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(ent.Level) {
+		return ce.AddCore(ent, c)
+	}
+	return ce
+}
+
+// Write implements zapcore.Core.
+func (c *journalCore) Write(ent zapcore.Entry, fields []zapcore.Field) error {
+	enc := zapcore.NewMapObjectEncoder()
+	for _, f := range c.fields {
+		f.AddTo(enc)
+	}
+	for _, f := range fields {
+		f.AddTo(enc)
+	}
+	var b bytes.Buffer
+	journalField(&b, "MESSAGE", ent.Message)
+	journalField(&b, "PRIORITY", strconv.Itoa(syslogSeverities[ent.Level]))
+	journalField(&b, "SYSLOG_IDENTIFIER", c.identifier)
+	if ent.LoggerName != "" {
+		journalField(&b, "LOGGER", ent.LoggerName)
+	}
+	if ent.Caller.Defined {
+		journalField(&b, "CODE_FILE", ent.Caller.File)
+		journalField(&b, "CODE_LINE", strconv.Itoa(ent.Caller.Line))
+		if ent.Caller.Function != "" {
+			journalField(&b, "CODE_FUNC", ent.Caller.Function)
+		}
+	}
+	if ent.Stack != "" {
+		journalField(&b, "STACKTRACE", ent.Stack)
+	}
+	for _, k := range sortedKeys(enc.Fields) {
+		if name := journalName(k); name != "" {
+			journalField(&b, name, fieldString(enc.Fields[k]))
+		}
+	}
+	_, err := c.w.Write(b.Bytes())
+	return err
+}
+
+// Sync implements zapcore.Core.
+func (c *journalCore) Sync() error {
+	return nil
+}
+
+// journalField 单行值写为 KEY=value，含换行的值写为 KEY\n + 64 位小端长度 + value
+func journalField(b *bytes.Buffer, key, value string) {
+	b.WriteString(key)
+	if !strings.ContainsRune(value, '\n') {
+		b.WriteByte('=')
+		b.WriteString(value)
+		b.WriteByte('\n')
+		return
+	}
+	b.WriteByte('\n')
+	_ = binary.Write(b, binary.LittleEndian, uint64(len(value)))
+	b.WriteString(value)
+	b.WriteByte('\n')
+}
+
+// journalReserved Write 写入的字段，同名的用户字段加 F_ 前缀，避免 journald 存为重复值
+var journalReserved = map[string]bool{
+	"MESSAGE":           true,
+	"PRIORITY":          true,
+	"SYSLOG_IDENTIFIER": true,
+	"LOGGER":            true,
+	"CODE_FILE":         true,
+	"CODE_LINE":         true,
+	"CODE_FUNC":         true,
+	"STACKTRACE":        true,
+}
+
+// journalName 字段名只允许大写字母 数字 下划线，不能以下划线(journald 受信字段)或数字开头，最长 64，与 journalReserved 同名时加 F_ 前缀
+func journalName(key string) string {
+	name := strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+			return r
+		case r >= 'a' && r <= 'z':
+			return r - 'a' + 'A'
+		default:
+			return '_'
+		}
+	}, key)
+	name = strings.TrimLeft(name, "_")
+	if journalReserved[name] || name != "" && name[0] >= '0' && name[0] <= '9' {
+		name = "F_" + name
+	}
+	if len(name) > 64 {
+		name = name[:64]
+	}
+	return name
+}
@@ -0,0 +1,17 @@
+//go:build !linux
+
+// @Author: openownworld
+// @Email:  openownworld@163.com
+// @File:   journald_other.go
+// @Description: 非 linux 平台不支持 journald 输出
+
+package zlog
+
+import (
+	"errors"
+	"io"
+)
+
+func newJournalWriter(addr string) (io.WriteCloser, error) {
+	return nil, errors.New("journald is only supported on linux")
+}
@@ -0,0 +1,113 @@
+//go:build linux
+
+package zlog
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// parseJournal 解析 native journal 协议的 entry
+func parseJournal(t *testing.T, data []byte) map[string]string {
+	fields := map[string]string{}
+	r := bufio.NewReader(bytes.NewReader(data))
+	for {
+		line, err := r.ReadString('\n')
+		if err == io.EOF {
+			return fields
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		line = strings.TrimSuffix(line, "\n")
+		if k, v, ok := strings.Cut(line, "="); ok {
+			fields[k] = v
+			continue
+		}
+		var n uint64
+		if err := binary.Read(r, binary.LittleEndian, &n); err != nil {
+			t.Fatal(err)
+		}
+		v := make([]byte, n+1)
+		if _, err := io.ReadFull(r, v); err != nil {
+			t.Fatal(err)
+		}
+		fields[line] = string(v[:n])
+	}
+}
+
+func TestJournalCore(t *testing.T) {
+	addr := filepath.Join(t.TempDir(), "journal.sock")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: addr, Net: "unixgram"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	logger, err := New(WithService("app"), WithJournal(JournalOptions{Addr: addr}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer logger.Close(context.Background())
+	read := func() map[string]string {
+		buf := make([]byte, 64*1024)
+		oob := make([]byte, syscall.CmsgSpace(4))
+		_ = conn.SetReadDeadline(time.Now().Add(time.Second))
+		n, oobn, _, _, err := conn.ReadMsgUnix(buf, oob)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if oobn == 0 {
+			return parseJournal(t, buf[:n])
+		}
+		// 大 entry 通过 memfd 传递
+		msgs, err := syscall.ParseSocketControlMessage(oob[:oobn])
+		if err != nil {
+			t.Fatal(err)
+		}
+		fds, err := syscall.ParseUnixRights(&msgs[0])
+		if err != nil {
+			t.Fatal(err)
+		}
+		f := os.NewFile(uintptr(fds[0]), "memfd")
+		defer f.Close()
+		// 与发送方共享文件偏移，从头读取
+		data, err := io.ReadAll(io.NewSectionReader(f, 0, 1<<30))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return parseJournal(t, data)
+	}
+
+	logger.WithFields(map[string]interface{}{"user-id": 7, "_trusted": "x", "note": "a\nb",
+		"message": "m", "priority": "p", "code_file": "c"}).Warn("hello journal")
+	f := read()
+	want := map[string]string{
+		"MESSAGE": "hello journal", "PRIORITY": "4", "SYSLOG_IDENTIFIER": "app",
+		"SERVICE": "app", "USER_ID": "7", "TRUSTED": "x", "NOTE": "a\nb",
+		"F_MESSAGE": "m", "F_PRIORITY": "p", "F_CODE_FILE": "c",
+	}
+	for k, v := range want {
+		if f[k] != v {
+			t.Fatalf("field %s = %q, want %q in %v", k, f[k], v, f)
+		}
+	}
+	if !strings.HasSuffix(f["CODE_FILE"], "journald_test.go") || f["CODE_LINE"] == "" {
+		t.Fatalf("unexpected caller fields %v", f)
+	}
+
+	big := strings.Repeat("x", 1<<20)
+	logger.Info(big)
+	if f := read(); f["MESSAGE"] != big {
+		t.Fatalf("unexpected large message length %d", len(f["MESSAGE"]))
+	}
+}
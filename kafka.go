@@ -0,0 +1,403 @@
+// @Author: openownworld
+// @Email:  openownworld@163.com
+// @File:   kafka.go
+// @Description: kafka 输出，json 编码后按 key 分区批量写入 topic，broker 不可用时写入本地 spill 文件
+
+package zlog
+
+import (
+	"bytes"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"time"
+
+	"go.uber.org/zap/zapcore"
+	"gopkg.in/natefinch/lumberjack.v2"
+)
+
+const (
+	KafkaAcksNone     = "0"   // 不等待 broker 确认
+	KafkaAcksLeader   = "1"   // leader 写入后确认
+	KafkaAcksAll      = "all" // 所有 ISR 副本写入后确认
+	KafkaCompressNone = "none"
+	KafkaCompressGzip = "gzip"
+
+	defaultKafkaClientID = "zlog"
+	defaultKafkaTimeout  = 10 * time.Second
+)
+
+var kafkaAcks = map[string]int16{"": 1, KafkaAcksNone: 0, KafkaAcksLeader: 1, KafkaAcksAll: -1, "-1": -1}
+
+var kafkaCodecs = map[string]int16{"": kafkaCodecNone, KafkaCompressNone: kafkaCodecNone, KafkaCompressGzip: kafkaCodecGzip}
+
+// KafkaOptions kafka 输出选项
+type KafkaOptions struct {
+	Brokers     []string      // bootstrap broker 地址 127.0.0.1:9092
+	Topic       string        // 写入的 topic，需已存在
+	KeyField    string        // 作为消息 key 的字段，如 request_id，相同 key 写入同一分区，为空或字段不存在时轮询分区
+	Acks        string        // 0 1 all，默认 1
+	Compression string        // none gzip，默认 none
+	Timeout     time.Duration // broker 等待副本确认的超时，默认 10s，客户端等待响应的超时再加 5s
+	ClientID    string        // 默认 zlog
+	TLS         *tls.Config   // 不为空时使用 tls 连接 broker
+	SpillFile   string        // broker 不可用、缓存已满或超过重试次数时写入的本地文件，每行一条 json，为空时丢弃
+	Spill       Rotation      // spill 文件切割策略
+	Batch       BatchOptions  // 分批、缓存与重试
+}
+
+// KafkaProducer 分批写入 kafka，按分区 leader 分组发送 Produce 请求
+// 连接错误和可重试的分区错误刷新 metadata 后按指数退避重试，其他失败的消息写入 spill 文件或丢弃
+type KafkaProducer struct {
+	opts  KafkaOptions
+	acks  int16
+	codec int16
+	b     *batcher[kafkaRecord]
+	spill *lumberjack.Logger
+	// 以下只在发送 goroutine 中使用
+	md    *kafkaMetadata
+	conns map[int32]*kafkaConn
+	next  int
+}
+
+// NewKafkaProducer 创建 kafka 输出，连接在首次发送时建立
+func NewKafkaProducer(opts KafkaOptions) (*KafkaProducer, error) {
+	if len(opts.Brokers) == 0 {
+		return nil, errors.New("kafka: brokers is required")
+	}
+	if opts.Topic == "" {
+		return nil, errors.New("kafka: topic is required")
+	}
+	acks, ok := kafkaAcks[strings.ToLower(opts.Acks)]
+	if !ok {
+		return nil, fmt.Errorf("kafka: unknown acks %q, want 0, 1 or all", opts.Acks)
+	}
+	codec, ok := kafkaCodecs[strings.ToLower(opts.Compression)]
+	if !ok {
+		return nil, fmt.Errorf("kafka: unknown compression %q, want none or gzip", opts.Compression)
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = defaultKafkaTimeout
+	}
+	if opts.ClientID == "" {
+		opts.ClientID = defaultKafkaClientID
+	}
+	p := &KafkaProducer{opts: opts, acks: acks, codec: codec, conns: map[int32]*kafkaConn{}}
+	var spill func([]kafkaRecord) error
+	if opts.SpillFile != "" {
+		p.spill = &lumberjack.Logger{
+			Filename:   opts.SpillFile,
+			MaxSize:    opts.Spill.MaxSize,
+			MaxBackups: opts.Spill.MaxBackups,
+			MaxAge:     opts.Spill.MaxDays,
+			Compress:   opts.Spill.Compress,
+		}
+		spill = p.writeSpill
+	}
+	p.b = newBatcher("kafka "+opts.Topic, opts.Batch, p.send, spill)
+	return p, nil
+}
+
+// Sync 立即发送缓存的消息
+func (p *KafkaProducer) Sync() error {
+	return p.b.sync()
+}
+
+// Close implements io.Closer. 尝试发送剩余消息，失败的写入 spill 文件，然后关闭连接
+func (p *KafkaProducer) Close() error {
+	err := p.b.close()
+	for id, c := range p.conns {
+		_ = c.conn.Close()
+		delete(p.conns, id)
+	}
+	if p.spill != nil {
+		err = errors.Join(err, p.spill.Close())
+	}
+	return err
+}
+
+// Dropped 无法发送且未写入 spill 文件而丢弃的消息条数
+func (p *KafkaProducer) Dropped() uint64 {
+	return p.b.dropped.Load()
+}
+
+// Spilled 写入 spill 文件的消息条数
+func (p *KafkaProducer) Spilled() uint64 {
+	return p.b.spilled.Load()
+}
+
+// writeSpill 每条消息一行写入 spill 文件
+func (p *KafkaProducer) writeSpill(records []kafkaRecord) error {
+	var buf bytes.Buffer
+	for _, r := range records {
+		buf.Write(r.value)
+		buf.WriteByte('\n')
+	}
+	_, err := p.spill.Write(buf.Bytes())
+	return err
+}
+
+// dial 连接 broker
+func (p *KafkaProducer) dial(addr string) (*kafkaConn, error) {
+	d := &net.Dialer{Timeout: socketDialTimeout}
+	var conn net.Conn
+	var err error
+	if p.opts.TLS != nil {
+		conn, err = tls.DialWithDialer(d, "tcp", addr, p.opts.TLS)
+	} else {
+		conn, err = d.Dial("tcp", addr)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &kafkaConn{conn: conn, clientID: p.opts.ClientID, timeout: p.opts.Timeout}, nil
+}
+
+// refresh 依次向 bootstrap broker 请求 topic metadata
+func (p *KafkaProducer) refresh() error {
+	var errs []error
+	for _, addr := range p.opts.Brokers {
+		c, err := p.dial(addr)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		md, err := c.metadata(p.opts.Topic)
+		_ = c.conn.Close()
+		if err != nil {
+			errs = append(errs, fmt.Errorf("kafka %s: %v", addr, err))
+			continue
+		}
+		p.md = md
+		return nil
+	}
+	return errors.Join(errs...)
+}
+
+// produce 向 leader 发送一个 Produce 请求，连接错误时关闭连接
+func (p *KafkaProducer) produce(leader int32, batches map[int32][]byte) (map[int32]int16, error) {
+	c := p.conns[leader]
+	if c == nil {
+		addr, ok := p.md.brokers[leader]
+		if !ok {
+			return nil, fmt.Errorf("kafka: unknown broker %d", leader)
+		}
+		var err error
+		if c, err = p.dial(addr); err != nil {
+			return nil, err
+		}
+		p.conns[leader] = c
+	}
+	codes, err := c.produce(p.opts.Topic, p.acks, p.opts.Timeout, batches)
+	if err != nil {
+		_ = c.conn.Close()
+		delete(p.conns, leader)
+		return nil, fmt.Errorf("kafka broker %d: %v", leader, err)
+	}
+	return codes, nil
+}
+
+// partition 有 key 时与 java 客户端默认分区器一致，无 key 时整批写入同一分区，每批轮询
+func (p *KafkaProducer) partition(key []byte, n int, sticky int32) int32 {
+	if key == nil {
+		return sticky
+	}
+	return (murmur2(key) & 0x7fffffff) % int32(n)
+}
+
+// sticky 无 key 消息本批写入的分区，在有 leader 的分区中轮询，都没有 leader 时返回 false
+func (p *KafkaProducer) sticky() (int32, bool) {
+	var live []int32
+	for part, leader := range p.md.leaders {
+		if leader >= 0 {
+			live = append(live, int32(part))
+		}
+	}
+	if len(live) == 0 {
+		return 0, false
+	}
+	part := live[p.next%len(live)]
+	p.next++
+	return part, true
+}
+
+// send 发送一批，返回需要重试的消息下标
+// 先为所有分区编码 record batch，编码失败的分区丢弃，其余分区正常发送
+func (p *KafkaProducer) send(records []kafkaRecord) ([]int, error) {
+	if p.md == nil {
+		if err := p.refresh(); err != nil {
+			return nil, err
+		}
+	}
+	n := len(p.md.leaders)
+	sticky, ok := p.sticky()
+	if !ok {
+		p.md = nil
+		return nil, errors.New("kafka: no partition has a leader")
+	}
+	byPartition := map[int32][]int{}
+	for i, r := range records {
+		part := p.partition(r.key, n, sticky)
+		byPartition[part] = append(byPartition[part], i)
+	}
+	var retry, rejected []int
+	var errs []error
+	byLeader := map[int32]map[int32][]byte{}
+	for part, idx := range byPartition {
+		leader := p.md.leaders[part]
+		if leader < 0 {
+			retry = append(retry, idx...)
+			errs = append(errs, fmt.Errorf("kafka: partition %d has no leader", part))
+			continue
+		}
+		rs := make([]kafkaRecord, len(idx))
+		for i, j := range idx {
+			rs[i] = records[j]
+		}
+		batch, err := recordBatch(rs, p.codec)
+		if err != nil {
+			rejected = append(rejected, idx...)
+			errs = append(errs, fmt.Errorf("kafka: partition %d: %v", part, err))
+			continue
+		}
+		if byLeader[leader] == nil {
+			byLeader[leader] = map[int32][]byte{}
+		}
+		byLeader[leader][part] = batch
+	}
+	for leader, batches := range byLeader {
+		codes, err := p.produce(leader, batches)
+		if err != nil {
+			for part := range batches {
+				retry = append(retry, byPartition[part]...)
+			}
+			errs = append(errs, err)
+			continue
+		}
+		if p.acks == 0 {
+			continue
+		}
+		for part := range batches {
+			code, ok := codes[part]
+			switch {
+			case ok && code == 0:
+			case !ok || kafkaRetriable[code] != "":
+				retry = append(retry, byPartition[part]...)
+				errs = append(errs, fmt.Errorf("kafka: partition %d error code %d %s", part, code, kafkaRetriable[code]))
+			default:
+				rejected = append(rejected, byPartition[part]...)
+				errs = append(errs, fmt.Errorf("kafka: partition %d error code %d", part, code))
+			}
+		}
+	}
+	if len(rejected) > 0 {
+		values := make([]kafkaRecord, len(rejected))
+		for i, idx := range rejected {
+			values[i] = records[idx]
+		}
+		p.b.reject(values, errors.Join(errs...))
+	}
+	if len(retry) > 0 {
+		// leader 可能已变化，重试前刷新 metadata
+		p.md = nil
+		return retry, errors.Join(errs...)
+	}
+	return nil, nil
+}
+
+// kafkaCore 使用 json 编码器编码日志，KeyField 字段值作为消息 key
+type kafkaCore struct {
+	zapcore.LevelEnabler
+	enc    zapcore.Encoder
+	p      *KafkaProducer
+	fields []zapcore.Field
+}
+
+// NewKafkaCore 创建 kafka 输出 core，enc 为空时使用与文件输出一致的 json 编码器(RFC 3339 时间)
+// 返回的 io.Closer 为 *KafkaProducer，可通过 Dropped Spilled 获取丢弃和写入 spill 文件的条数
+func NewKafkaCore(opts KafkaOptions, enc zapcore.Encoder) (zapcore.Core, io.Closer, error) {
+	p, err := NewKafkaProducer(opts)
+	if err != nil {
+		return nil, nil, err
+	}
+	if enc == nil {
+		enc = newEncoder(EncoderOption{formatter: "json", timeFmt: "rfc3339", shortCaller: true})
+	}
+	return &kafkaCore{LevelEnabler: zapcore.DebugLevel, enc: enc, p: p}, p, nil
+}
+
+// With implements zapcore.Core.
+func (c *kafkaCore) With(fields []zapcore.Field) zapcore.Core {
+	n := *c
+	n.enc = c.enc.Clone()
+	for _, f := range fields {
+		f.AddTo(n.enc)
+	}
+	n.fields = make([]zapcore.Field, 0, len(c.fields)+len(fields))
+	n.fields = append(n.fields, c.fields...)
+	n.fields = append(n.fields, fields...)
+	return &n
+}
+
+// Check implements zapcore.Core.
+func (c *kafkaCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(ent.Level) {
+		return ce.AddCore(ent, c)
+	}
+	return ce
+}
+
+// Write implements zapcore.Core.
+func (c *kafkaCore) Write(ent zapcore.Entry, fields []zapcore.Field) error {
+	buf, err := c.enc.EncodeEntry(ent, fields)
+	if err != nil {
+		return err
+	}
+	r := kafkaRecord{value: append([]byte(nil), bytes.TrimRight(buf.Bytes(), "\n")...), time: ent.Time}
+	buf.Free()
+	if c.p.opts.KeyField != "" {
+		if key := lookupField(c.p.opts.KeyField, ent, fields, c.fields); key != "" {
+			r.key = []byte(key)
+		}
+	}
+	c.p.b.post(r, len(r.key)+len(r.value))
+	return nil
+}
+
+// Sync implements zapcore.Core.
+func (c *kafkaCore) Sync() error {
+	return c.p.Sync()
+}
+
+// newConfigKafkaCore 按 Config 创建 kafka 输出，spill 文件与日志文件使用相同的切割策略，tls 使用 socketTLS* 证书配置
+func newConfigKafkaCore(logConfig Config) (zapcore.Core, io.Closer, error) {
+	opts := KafkaOptions{
+		Topic:       logConfig.KafkaTopic,
+		KeyField:    logConfig.KafkaKeyField,
+		Acks:        logConfig.KafkaAcks,
+		Compression: logConfig.KafkaCompression,
+		SpillFile:   logConfig.KafkaSpillFile,
+		Spill:       Rotation{MaxSize: logConfig.MaxSize, MaxBackups: logConfig.MaxBackups, MaxDays: logConfig.MaxDays, Compress: logConfig.Compress},
+	}
+	for _, b := range strings.Split(logConfig.KafkaBrokers, ",") {
+		if b = strings.TrimSpace(b); b != "" {
+			opts.Brokers = append(opts.Brokers, b)
+		}
+	}
+	if logConfig.KafkaTLS {
+		c, err := configTLS(logConfig)
+		if err != nil {
+			return nil, nil, fmt.Errorf("kafka: %v", err)
+		}
+		opts.TLS = c
+	}
+	enc := newEncoder(EncoderOption{formatter: "json", timeFmt: "rfc3339", shortCaller: logConfig.ShortCaller, function: logConfig.FunctionEnable})
+	c, closer, err := NewKafkaCore(opts, enc)
+	if err != nil {
+		return nil, nil, err
+	}
+	return c, closer, nil
+}
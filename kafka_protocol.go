@@ -0,0 +1,395 @@
+// @Author: openownworld
+// @Email:  openownworld@163.com
+// @File:   kafka_protocol.go
+// @Description: kafka 协议编码，Metadata v4 Produce v3 与 v2 RecordBatch
+
+package zlog
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"net"
+	"time"
+)
+
+const (
+	kafkaProduceKey     = 0
+	kafkaMetadataKey    = 3
+	kafkaProduceVersion = 3
+	kafkaMetaVersion    = 4
+	kafkaCodecNone      = 0
+	kafkaCodecGzip      = 1
+	kafkaMaxResponse    = 64 << 20
+)
+
+var crc32c = crc32.MakeTable(crc32.Castagnoli)
+
+// kafkaRetriable 可重试的分区错误码，重试前刷新 metadata
+var kafkaRetriable = map[int16]string{
+	3:  "UNKNOWN_TOPIC_OR_PARTITION",
+	5:  "LEADER_NOT_AVAILABLE",
+	6:  "NOT_LEADER_OR_FOLLOWER",
+	7:  "REQUEST_TIMED_OUT",
+	13: "NETWORK_EXCEPTION",
+	19: "NOT_ENOUGH_REPLICAS",
+	20: "NOT_ENOUGH_REPLICAS_AFTER_APPEND",
+}
+
+// kafkaEncoder 大端编码，varint 为 zigzag 编码
+type kafkaEncoder struct {
+	b []byte
+}
+
+func (e *kafkaEncoder) int8(v int8)   { e.b = append(e.b, byte(v)) }
+func (e *kafkaEncoder) int16(v int16) { e.b = binary.BigEndian.AppendUint16(e.b, uint16(v)) }
+func (e *kafkaEncoder) int32(v int32) { e.b = binary.BigEndian.AppendUint32(e.b, uint32(v)) }
+func (e *kafkaEncoder) int64(v int64) { e.b = binary.BigEndian.AppendUint64(e.b, uint64(v)) }
+func (e *kafkaEncoder) varint(v int64) {
+	e.b = binary.AppendVarint(e.b, v)
+}
+
+func (e *kafkaEncoder) string(s string) {
+	e.int16(int16(len(s)))
+	e.b = append(e.b, s...)
+}
+
+func (e *kafkaEncoder) bytes(p []byte) {
+	e.int32(int32(len(p)))
+	e.b = append(e.b, p...)
+}
+
+// kafkaDecoder 解码响应，出错后后续读取均返回零值，由 err 统一检查
+type kafkaDecoder struct {
+	b   []byte
+	err error
+}
+
+func (d *kafkaDecoder) next(n int) []byte {
+	if d.err != nil {
+		return nil
+	}
+	if n < 0 || len(d.b) < n {
+		d.err = errors.New("kafka: short response")
+		return nil
+	}
+	p := d.b[:n]
+	d.b = d.b[n:]
+	return p
+}
+
+func (d *kafkaDecoder) int8() int8 {
+	if p := d.next(1); p != nil {
+		return int8(p[0])
+	}
+	return 0
+}
+
+func (d *kafkaDecoder) int16() int16 {
+	if p := d.next(2); p != nil {
+		return int16(binary.BigEndian.Uint16(p))
+	}
+	return 0
+}
+
+func (d *kafkaDecoder) int32() int32 {
+	if p := d.next(4); p != nil {
+		return int32(binary.BigEndian.Uint32(p))
+	}
+	return 0
+}
+
+func (d *kafkaDecoder) int64() int64 {
+	if p := d.next(8); p != nil {
+		return int64(binary.BigEndian.Uint64(p))
+	}
+	return 0
+}
+
+func (d *kafkaDecoder) varint() int64 {
+	if d.err != nil {
+		return 0
+	}
+	v, n := binary.Varint(d.b)
+	if n <= 0 {
+		d.err = errors.New("kafka: invalid varint")
+		return 0
+	}
+	d.b = d.b[n:]
+	return v
+}
+
+// string 可为 null(-1)
+func (d *kafkaDecoder) string() string {
+	n := d.int16()
+	if n < 0 {
+		return ""
+	}
+	return string(d.next(int(n)))
+}
+
+func (d *kafkaDecoder) bytes() []byte {
+	n := d.int32()
+	if n < 0 {
+		return nil
+	}
+	return d.next(int(n))
+}
+
+// array 读取数组长度，null(-1) 按 0 处理
+func (d *kafkaDecoder) array() int {
+	n := d.int32()
+	if n < 0 || int(n) > len(d.b) {
+		if n > 0 {
+			d.err = errors.New("kafka: invalid array length")
+		}
+		return 0
+	}
+	return int(n)
+}
+
+// kafkaConn 一个 broker 连接，请求按顺序发送并等待响应
+type kafkaConn struct {
+	conn     net.Conn
+	clientID string
+	corrID   int32
+	timeout  time.Duration // produce 请求 broker 最多等待的时间
+}
+
+// request 发送请求，noResponse 为 acks=0 的 produce 请求，broker 不返回响应
+func (c *kafkaConn) request(key, version int16, body []byte, noResponse bool) ([]byte, error) {
+	c.corrID++
+	var e kafkaEncoder
+	e.int32(0)
+	e.int16(key)
+	e.int16(version)
+	e.int32(c.corrID)
+	e.string(c.clientID)
+	e.b = append(e.b, body...)
+	binary.BigEndian.PutUint32(e.b, uint32(len(e.b)-4))
+	// broker 最多等待 timeout 后返回，再留出网络往返的余量，避免客户端先超时重发造成重复写入
+	_ = c.conn.SetDeadline(time.Now().Add(c.timeout + socketWriteTimeout))
+	if _, err := c.conn.Write(e.b); err != nil {
+		return nil, err
+	}
+	if noResponse {
+		return nil, nil
+	}
+	var head [8]byte
+	if _, err := io.ReadFull(c.conn, head[:]); err != nil {
+		return nil, err
+	}
+	size := int32(binary.BigEndian.Uint32(head[:4]))
+	if size < 4 || size > kafkaMaxResponse {
+		return nil, fmt.Errorf("kafka: invalid response size %d", size)
+	}
+	if corr := int32(binary.BigEndian.Uint32(head[4:])); corr != c.corrID {
+		return nil, fmt.Errorf("kafka: correlation id %d, want %d", corr, c.corrID)
+	}
+	resp := make([]byte, size-4)
+	if _, err := io.ReadFull(c.conn, resp); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// kafkaMetadata topic 各分区的 leader 与 broker 地址
+type kafkaMetadata struct {
+	brokers map[int32]string
+	leaders []int32 // 下标为分区号，leader 不可用时为 -1
+}
+
+// metadata Metadata v4 请求单个 topic，不自动创建 topic
+func (c *kafkaConn) metadata(topic string) (*kafkaMetadata, error) {
+	var e kafkaEncoder
+	e.int32(1)
+	e.string(topic)
+	e.int8(0)
+	resp, err := c.request(kafkaMetadataKey, kafkaMetaVersion, e.b, false)
+	if err != nil {
+		return nil, err
+	}
+	d := &kafkaDecoder{b: resp}
+	md := &kafkaMetadata{brokers: map[int32]string{}}
+	d.int32() // throttle_time_ms
+	for i, n := 0, d.array(); i < n; i++ {
+		id := d.int32()
+		host := d.string()
+		port := d.int32()
+		d.string() // rack
+		md.brokers[id] = net.JoinHostPort(host, fmt.Sprint(port))
+	}
+	d.string() // cluster_id
+	d.int32()  // controller_id
+	var topicErr int16
+	for i, n := 0, d.array(); i < n; i++ {
+		code := d.int16()
+		name := d.string()
+		d.int8() // is_internal
+		for j, m := 0, d.array(); j < m; j++ {
+			d.int16() // partition error_code
+			index := d.int32()
+			leader := d.int32()
+			for k, r := 0, d.array(); k < r; k++ {
+				d.int32()
+			}
+			for k, r := 0, d.array(); k < r; k++ {
+				d.int32()
+			}
+			if name != topic || index < 0 || index >= 1<<16 {
+				continue
+			}
+			for int(index) >= len(md.leaders) {
+				md.leaders = append(md.leaders, -1)
+			}
+			md.leaders[index] = leader
+		}
+		if name == topic {
+			topicErr = code
+		}
+	}
+	if d.err != nil {
+		return nil, d.err
+	}
+	if len(md.leaders) == 0 {
+		return nil, fmt.Errorf("kafka: topic %s has no partitions, error code %d", topic, topicErr)
+	}
+	return md, nil
+}
+
+// kafkaRecord 一条消息
+type kafkaRecord struct {
+	key   []byte
+	value []byte
+	time  time.Time
+}
+
+// recordBatch 编码 v2 RecordBatch，records 部分按 codec 压缩
+func recordBatch(records []kafkaRecord, codec int16) ([]byte, error) {
+	base := records[0].time.UnixMilli()
+	maxTime := base
+	var body kafkaEncoder
+	for i, r := range records {
+		ts := r.time.UnixMilli()
+		maxTime = max(maxTime, ts)
+		var rec kafkaEncoder
+		rec.int8(0) // attributes
+		rec.varint(ts - base)
+		rec.varint(int64(i))
+		if r.key == nil {
+			rec.varint(-1)
+		} else {
+			rec.varint(int64(len(r.key)))
+			rec.b = append(rec.b, r.key...)
+		}
+		rec.varint(int64(len(r.value)))
+		rec.b = append(rec.b, r.value...)
+		rec.varint(0) // headers
+		body.varint(int64(len(rec.b)))
+		body.b = append(body.b, rec.b...)
+	}
+	data := body.b
+	if codec == kafkaCodecGzip {
+		var buf bytes.Buffer
+		zw := gzip.NewWriter(&buf)
+		if _, err := zw.Write(data); err != nil {
+			return nil, err
+		}
+		if err := zw.Close(); err != nil {
+			return nil, err
+		}
+		data = buf.Bytes()
+	}
+	// crc 覆盖 attributes 到结尾
+	var crcPart kafkaEncoder
+	crcPart.int16(codec)
+	crcPart.int32(int32(len(records) - 1))
+	crcPart.int64(base)
+	crcPart.int64(maxTime)
+	crcPart.int64(-1) // producer_id
+	crcPart.int16(-1) // producer_epoch
+	crcPart.int32(-1) // base_sequence
+	crcPart.int32(int32(len(records)))
+	crcPart.b = append(crcPart.b, data...)
+	var e kafkaEncoder
+	e.int64(0) // base_offset
+	e.int32(int32(4 + 1 + 4 + len(crcPart.b)))
+	e.int32(-1) // partition_leader_epoch
+	e.int8(2)   // magic
+	e.b = binary.BigEndian.AppendUint32(e.b, crc32.Checksum(crcPart.b, crc32c))
+	e.b = append(e.b, crcPart.b...)
+	return e.b, nil
+}
+
+// produce Produce v3 请求，返回各分区错误码，acks=0 时不等待响应
+func (c *kafkaConn) produce(topic string, acks int16, timeout time.Duration, batches map[int32][]byte) (map[int32]int16, error) {
+	var e kafkaEncoder
+	e.int16(-1) // transactional_id null
+	e.int16(acks)
+	e.int32(int32(timeout / time.Millisecond))
+	e.int32(1)
+	e.string(topic)
+	e.int32(int32(len(batches)))
+	for p, batch := range batches {
+		e.int32(p)
+		e.bytes(batch)
+	}
+	resp, err := c.request(kafkaProduceKey, kafkaProduceVersion, e.b, acks == 0)
+	if err != nil || acks == 0 {
+		return nil, err
+	}
+	d := &kafkaDecoder{b: resp}
+	codes := map[int32]int16{}
+	for i, n := 0, d.array(); i < n; i++ {
+		d.string()
+		for j, m := 0, d.array(); j < m; j++ {
+			p := d.int32()
+			codes[p] = d.int16()
+			d.int64() // base_offset
+			d.int64() // log_append_time_ms
+		}
+	}
+	if d.err != nil {
+		return nil, d.err
+	}
+	return codes, nil
+}
+
+// murmur2 与 java 客户端默认分区器一致的哈希
+func murmur2(data []byte) int32 {
+	const (
+		seed uint32 = 0x9747b28c
+		m    uint32 = 0x5bd1e995
+		r           = 24
+	)
+	h := seed ^ uint32(len(data))
+	n := len(data) / 4
+	for i := 0; i < n; i++ {
+		k := binary.LittleEndian.Uint32(data[i*4:])
+		k *= m
+		k ^= k >> r
+		k *= m
+		h *= m
+		h ^= k
+	}
+	tail := data[n*4:]
+	switch len(tail) {
+	case 3:
+		h ^= uint32(tail[2]) << 16
+		fallthrough
+	case 2:
+		h ^= uint32(tail[1]) << 8
+		fallthrough
+	case 1:
+		h ^= uint32(tail[0])
+		h *= m
+	}
+	h ^= h >> 13
+	h *= m
+	h ^= h >> 15
+	return int32(h)
+}
@@ -0,0 +1,318 @@
+package zlog
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"encoding/json"
+	"hash/crc32"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+type kafkaMessage struct {
+	partition int32
+	key       string
+	value     map[string]interface{}
+}
+
+// fakeKafka 单个 broker，topic 有 partitions 个分区，leader 均为自己
+func fakeKafka(t *testing.T, topic string, partitions int32) (string, <-chan kafkaMessage) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return serveFakeKafka(t, ln, topic, partitions)
+}
+
+// serveFakeKafka 在 ln 上运行 fakeKafka
+func serveFakeKafka(t *testing.T, ln net.Listener, topic string, partitions int32) (string, <-chan kafkaMessage) {
+	t.Cleanup(func() { ln.Close() })
+	host, port, _ := net.SplitHostPort(ln.Addr().String())
+	portNum, _ := strconv.Atoi(port)
+	msgs := make(chan kafkaMessage, 100)
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				for {
+					var head [4]byte
+					if _, err := io.ReadFull(conn, head[:]); err != nil {
+						return
+					}
+					req := make([]byte, binary.BigEndian.Uint32(head[:]))
+					if _, err := io.ReadFull(conn, req); err != nil {
+						return
+					}
+					d := &kafkaDecoder{b: req}
+					key, version, corr := d.int16(), d.int16(), d.int32()
+					d.string() // client_id
+					var resp kafkaEncoder
+					resp.int32(0)
+					resp.int32(corr)
+					switch {
+					case key == kafkaMetadataKey && version == kafkaMetaVersion:
+						resp.int32(0)
+						resp.int32(1)
+						resp.int32(0)
+						resp.string(host)
+						resp.int32(int32(portNum))
+						resp.int16(-1)
+						resp.int16(-1)
+						resp.int32(0)
+						resp.int32(1)
+						resp.int16(0)
+						resp.string(topic)
+						resp.int8(0)
+						resp.int32(partitions)
+						for p := int32(0); p < partitions; p++ {
+							resp.int16(0)
+							resp.int32(p)
+							resp.int32(0)
+							resp.int32(1)
+							resp.int32(0)
+							resp.int32(1)
+							resp.int32(0)
+						}
+					case key == kafkaProduceKey && version == kafkaProduceVersion:
+						d.string()
+						d.int16()
+						d.int32()
+						resp.int32(1)
+						for i, n := 0, d.array(); i < n; i++ {
+							name := d.string()
+							m := d.array()
+							resp.string(name)
+							resp.int32(int32(m))
+							for j := 0; j < m; j++ {
+								p := d.int32()
+								for _, msg := range decodeRecordBatch(t, d.bytes()) {
+									msg.partition = p
+									msgs <- msg
+								}
+								resp.int32(p)
+								resp.int16(0)
+								resp.int64(0)
+								resp.int64(-1)
+							}
+						}
+						resp.int32(0)
+					default:
+						t.Errorf("unexpected request key %d version %d", key, version)
+						return
+					}
+					binary.BigEndian.PutUint32(resp.b, uint32(len(resp.b)-4))
+					if _, err := conn.Write(resp.b); err != nil {
+						return
+					}
+				}
+			}()
+		}
+	}()
+	return ln.Addr().String(), msgs
+}
+
+// decodeRecordBatch 解码 v2 RecordBatch，校验 crc
+func decodeRecordBatch(t *testing.T, b []byte) []kafkaMessage {
+	d := &kafkaDecoder{b: b}
+	d.int64()
+	d.int32()
+	d.int32()
+	if magic := d.int8(); magic != 2 {
+		t.Errorf("unexpected magic %d", magic)
+	}
+	crc := uint32(d.int32())
+	if crc32.Checksum(d.b, crc32c) != crc {
+		t.Errorf("crc mismatch")
+	}
+	codec := d.int16()
+	d.next(4 + 8 + 8 + 8 + 2 + 4)
+	count := d.int32()
+	data := d.b
+	if codec == kafkaCodecGzip {
+		zr, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if data, err = io.ReadAll(zr); err != nil {
+			t.Fatal(err)
+		}
+	}
+	d = &kafkaDecoder{b: data}
+	var msgs []kafkaMessage
+	for i := int32(0); i < count; i++ {
+		d.varint()
+		d.int8()
+		d.varint()
+		d.varint()
+		var msg kafkaMessage
+		if n := d.varint(); n >= 0 {
+			msg.key = string(d.next(int(n)))
+		}
+		if err := json.Unmarshal(d.next(int(d.varint())), &msg.value); err != nil {
+			t.Errorf("unexpected value: %v", err)
+		}
+		d.varint()
+		msgs = append(msgs, msg)
+	}
+	if d.err != nil {
+		t.Errorf("decode records: %v", d.err)
+	}
+	return msgs
+}
+
+func TestMurmur2(t *testing.T) {
+	// 与 java 客户端 Utils.murmur2 一致
+	for s, want := range map[string]int32{
+		"21":                         -973932308,
+		"foobar":                     -790332482,
+		"a-little-bit-long-string":   -985981536,
+		"a-little-bit-longer-string": -1486304829,
+		"abc":                        479470107,
+	} {
+		if got := murmur2([]byte(s)); got != want {
+			t.Errorf("murmur2(%q) = %d, want %d", s, got, want)
+		}
+	}
+}
+
+func TestKafkaProduce(t *testing.T) {
+	addr, msgs := fakeKafka(t, "logs", 3)
+	logger, err := New(WithService("app"), WithKafka(KafkaOptions{Brokers: []string{addr}, Topic: "logs",
+		KeyField: "request_id", Compression: KafkaCompressGzip, Batch: BatchOptions{BatchSize: 3, FlushInterval: time.Hour}}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer logger.Close(context.Background())
+	logger.WithField("request_id", "21").Info("first")
+	logger.WithField("request_id", "abc").Warn("second")
+	logger.Info("third")
+	got := map[string]kafkaMessage{}
+	for len(got) < 3 {
+		select {
+		case m := <-msgs:
+			got[m.value["msg"].(string)] = m
+		case <-time.After(2 * time.Second):
+			t.Fatalf("timeout, got %v", got)
+		}
+	}
+	for msg, key := range map[string]string{"first": "21", "second": "abc"} {
+		m := got[msg]
+		if m.key != key || m.partition != (murmur2([]byte(key))&0x7fffffff)%3 || m.value["service"] != "app" {
+			t.Fatalf("unexpected message %s: %+v", msg, m)
+		}
+	}
+	if m := got["third"]; m.key != "" || m.value["level"] != "info" {
+		t.Fatalf("unexpected message third: %+v", m)
+	}
+}
+
+func TestKafkaConfigTLS(t *testing.T) {
+	dir := t.TempDir()
+	ca, caKey, caFile, _ := writeTestCert(t, dir, "ca", nil, nil, true)
+	_, _, serverCert, serverKey := writeTestCert(t, dir, "localhost", ca, caKey, false)
+	cert, err := tls.LoadX509KeyPair(serverCert, serverKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ln, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{Certificates: []tls.Certificate{cert}, MinVersion: tls.VersionTLS12})
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr, msgs := serveFakeKafka(t, ln, "logs", 1)
+	cfg := GetDefaultConfig()
+	cfg.FileLogger, cfg.ConsoleLogger = false, false
+	cfg.KafkaEnable, cfg.KafkaBrokers, cfg.KafkaTopic, cfg.KafkaTLS = true, addr, "logs", true
+	cfg.SocketTLSCA, cfg.SocketTLSServer = caFile, "localhost"
+	logger, err := newZLogger(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer logger.Close(context.Background())
+	logger.Info("over tls")
+	_ = logger.Sync()
+	select {
+	case m := <-msgs:
+		if m.value["msg"] != "over tls" {
+			t.Fatalf("unexpected message %+v", m)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("timeout waiting for tls produce")
+	}
+}
+
+func TestKafkaSpill(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+	spill := filepath.Join(t.TempDir(), "kafka.log")
+	core, closer, err := NewKafkaCore(KafkaOptions{Brokers: []string{addr}, Topic: "logs", SpillFile: spill,
+		Batch: BatchOptions{BatchSize: 2, MaxRetries: 1, MinBackoff: time.Millisecond, MaxBackoff: time.Millisecond}}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := closer.(*KafkaProducer)
+	logger := zap.New(core)
+	logger.Info("first")
+	logger.Info("second")
+	// 超过重试次数后写入 spill 文件
+	deadline := time.Now().Add(2 * time.Second)
+	for p.Spilled() < 2 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if err := closer.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if p.Spilled() != 2 || p.Dropped() != 0 {
+		t.Fatalf("spilled %d dropped %d", p.Spilled(), p.Dropped())
+	}
+	f, err := os.Open(spill)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var lines []string
+	for s := bufio.NewScanner(f); s.Scan(); {
+		lines = append(lines, s.Text())
+	}
+	if len(lines) != 2 || !strings.Contains(lines[0], `"msg":"first"`) || !strings.Contains(lines[1], `"msg":"second"`) {
+		t.Fatalf("unexpected spill file %q", lines)
+	}
+}
+
+func TestKafkaStickySkipsLeaderless(t *testing.T) {
+	p := &KafkaProducer{md: &kafkaMetadata{leaders: []int32{-1, 2, -1, 3}}}
+	var got []int32
+	for i := 0; i < 3; i++ {
+		part, ok := p.sticky()
+		if !ok {
+			t.Fatal("expect live partition")
+		}
+		got = append(got, part)
+	}
+	if len(got) != 3 || got[0] != 1 || got[1] != 3 || got[2] != 1 {
+		t.Fatalf("sticky partitions %v", got)
+	}
+	p.md = &kafkaMetadata{leaders: []int32{-1}}
+	if _, ok := p.sticky(); ok {
+		t.Fatal("expect no live partition")
+	}
+}
@@ -6,6 +6,7 @@
 package zlog
 
 import (
+	"context"
 	"fmt"
 	"runtime"
 	"runtime/debug"
@@ -44,11 +45,37 @@ func Sync() error {
 	return GetDefaultLogger().Sync()
 }
 
+// Close flushes and closes every output of the default logger.
+func Close(ctx context.Context) error {
+	return GetDefaultLogger().Close(ctx)
+}
+
+// AsyncDropped 默认 logger 异步输出丢弃的日志条数
+func AsyncDropped() uint64 {
+	if z, ok := unwrapZLogger(GetDefaultLogger()); ok {
+		return z.AsyncDropped()
+	}
+	return 0
+}
+
+// SinkDropped 默认 logger 的 socket loki kafka webhook 等输出丢弃的日志条数
+func SinkDropped() uint64 {
+	if z, ok := unwrapZLogger(GetDefaultLogger()); ok {
+		return z.SinkDropped()
+	}
+	return 0
+}
+
 // SetLevel set the output log level.
 func SetLevel(level Level) {
 	GetDefaultLogger().SetLevel(level)
 }
 
+// GetLevel get the output log level.
+func GetLevel() Level {
+	return GetDefaultLogger().GetLevel()
+}
+
 // Println 打印日志到终端
 func Println(args ...interface{}) {
 	GetDefaultLogger().Println(args...)
@@ -1,9 +1,13 @@
 package zlog
 
 import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
 	"testing"
 
 	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
 )
 
 func TestLoggerDefault(t *testing.T) {
@@ -71,3 +75,109 @@ func TestCfgJson(t *testing.T) {
 	Error("A", "B")
 	WithField("log", "test").Info("A", "B")
 }
+
+func TestLoggerLevelIndependent(t *testing.T) {
+	cfg := GetDefaultConfig()
+	cfg.FileLogger = false
+	a := NewZLogger(cfg)
+	b := NewZLogger(cfg)
+	child := a.WithField("log", "child")
+	a.SetLevel(LevelError)
+	if a.GetLevel() != LevelError || child.GetLevel() != LevelError {
+		t.Fatalf("a level %v child level %v", a.GetLevel(), child.GetLevel())
+	}
+	if b.GetLevel() != LevelDebug {
+		t.Fatalf("b level changed to %v", b.GetLevel())
+	}
+	child.SetLevel(LevelWarn)
+	if a.GetLevel() != LevelWarn {
+		t.Fatalf("child SetLevel not shared, a level %v", a.GetLevel())
+	}
+}
+
+func TestNamedLevel(t *testing.T) {
+	cfg := GetDefaultConfig()
+	cfg.FileLogger = false
+	cfg.Level = "info"
+	if err := InitLog(cfg); err != nil {
+		t.Fatal(err)
+	}
+	defer InitLog(GetDefaultConfig())
+	root := GetDefaultLogger()
+	gateway := root.Named("payments").Named("gateway")
+	refund := root.Named("payments.refund")
+	enabled := func(l Logger, lvl zapcore.Level) bool {
+		if w, ok := l.(*zLogWrapper); ok {
+			l = w.logger
+		}
+		return l.(*zLogger).logger.Core().Enabled(lvl)
+	}
+	if err := SetNamedLevels("payments=warn, payments.gateway=debug"); err != nil {
+		t.Fatal(err)
+	}
+	defer ResetNamedLevel("payments")
+	defer ResetNamedLevel("payments.gateway")
+	if gateway.GetLevel() != LevelDebug || !enabled(gateway, zapcore.DebugLevel) {
+		t.Fatalf("gateway level %v", gateway.GetLevel())
+	}
+	if refund.GetLevel() != LevelWarn || enabled(refund, zapcore.InfoLevel) {
+		t.Fatalf("refund level %v", refund.GetLevel())
+	}
+	if root.GetLevel() != LevelInfo || enabled(root, zapcore.DebugLevel) {
+		t.Fatalf("root level %v", root.GetLevel())
+	}
+	ResetNamedLevel("payments")
+	if refund.GetLevel() != LevelInfo {
+		t.Fatalf("refund level %v after reset", refund.GetLevel())
+	}
+	gateway.Debug("gateway debug")
+	if err := SetNamedLevels("payments=verbose"); err == nil {
+		t.Fatal("expect error for unknown level")
+	}
+}
+
+func TestNamedLevelPerRoot(t *testing.T) {
+	cfg := GetDefaultConfig()
+	cfg.FileLogger = false
+	cfg.Level = "info"
+	a := NewZLogger(cfg).Named("db")
+	b := NewZLogger(cfg).Named("db")
+	a.SetLevel(LevelError)
+	if a.GetLevel() != LevelError || b.GetLevel() != LevelInfo {
+		t.Fatalf("a %v b %v", a.GetLevel(), b.GetLevel())
+	}
+	if _, ok := NamedLevels()["db"]; ok {
+		t.Fatal("override leaked to default logger")
+	}
+}
+
+func TestLoggerNamesBounded(t *testing.T) {
+	cfg := GetDefaultConfig()
+	cfg.FileLogger, cfg.ConsoleLogger = false, false
+	z, _ := unwrapZLogger(NewZLogger(cfg))
+	for i := 0; i < maxLoggerNames+10; i++ {
+		z.Named(fmt.Sprintf("tenant%d", i))
+	}
+	if n := len(z.h.levels.names); n != maxLoggerNames {
+		t.Fatalf("%d names recorded, want %d", n, maxLoggerNames)
+	}
+}
+
+func TestSinkDropped(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "rejected", http.StatusBadRequest)
+	}))
+	defer srv.Close()
+	cfg := GetDefaultConfig()
+	cfg.FileLogger, cfg.ConsoleLogger = false, false
+	cfg.WebhookEnable, cfg.WebhookURL = true, srv.URL
+	if err := InitLog(cfg); err != nil {
+		t.Fatal(err)
+	}
+	defer InitLog(GetDefaultConfig())
+	Error("rejected by webhook")
+	_ = Sync()
+	if n := SinkDropped(); n != 1 {
+		t.Fatalf("SinkDropped %d, want 1", n)
+	}
+}
@@ -1,5 +1,7 @@
 package zlog
 
+import "context"
+
 // Level is the log level.
 type Level int
 
@@ -83,8 +85,14 @@ type Logger interface {
 	// Applications should take care to call Sync before exiting.
 	// 在默认情况下，日志记录器是没有缓冲的。但是在进程退出之前调用 Sync() 方法是一个好习惯。
 	Sync() error
+	// Close flushes and closes every output, entries logged afterwards are dropped.
+	// 关闭文件、socket 等所有输出，With 派生的子 logger 共享输出。
+	Close(ctx context.Context) error
 	// SetLevel set the output log level.
+	// 只作用于当前 logger 及其 With/WithField 派生的子 logger。
 	SetLevel(level Level)
+	// GetLevel get the output log level.
+	GetLevel() Level
 	// WithFields set some user defined data to logs, such as uid, imei, etc.
 	// Fields must be paired.
 	WithFields(fields map[string]interface{}) Logger
@@ -92,6 +100,8 @@ type Logger interface {
 	WithField(key string, value interface{}) Logger
 	// With add user defined fields to Logger. Fields support multiple values.
 	With(fields ...Field) Logger
+	// Named adds a new path segment to the logger's name, level can be overridden by name prefix.
+	Named(name string) Logger
 	// Log 兼容 Kratos Logger 接口，接收日志级别和键值对参数
 	Log(level Level, keyvals ...any) error
 }
@@ -0,0 +1,311 @@
+// @Author: openownworld
+// @Email:  openownworld@163.com
+// @File:   loki.go
+// @Description: Grafana Loki push 输出，指定字段作为 label，其余内容写入日志行，protobuf+snappy 或 json
+
+package zlog
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang/snappy"
+	"go.uber.org/zap/zapcore"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// Enums loki format constants.
+const (
+	LokiProtobuf = "protobuf"
+	LokiJSON     = "json"
+)
+
+const lokiPushPath = "/loki/api/v1/push"
+
+// LokiOptions Loki 输出选项
+type LokiOptions struct {
+	URL          string            // Loki 地址 http://127.0.0.1:3100，没有路径时使用 /loki/api/v1/push
+	Format       string            // protobuf json，默认 protobuf(snappy 压缩)
+	Labels       []string          // 作为 label 的字段，level 为级别，logger 为命名 logger 名称，默认 service level logger
+	StaticLabels map[string]string // 固定 label，如 env=prod
+	TenantID     string            // 多租户 X-Scope-OrgID
+	Header       http.Header       // 额外的请求头，如 Authorization
+	Client       *http.Client      // 默认超时 10s 的 http.Client
+	Batch        BatchOptions      // 分批、缓存与重试
+}
+
+// lokiEntry 一条日志，key 为排序后的 label 字符串，相同 key 的日志属于同一个 stream
+type lokiEntry struct {
+	key    string
+	labels map[string]string
+	time   time.Time
+	line   string
+}
+
+// LokiClient 分批推送日志到 Loki，失败按指数退避重试
+type LokiClient struct {
+	opts   LokiOptions
+	url    string
+	labels map[string]bool
+	b      *batcher[lokiEntry]
+}
+
+// NewLokiClient 创建 Loki 输出
+func NewLokiClient(opts LokiOptions) (*LokiClient, error) {
+	u, err := url.Parse(opts.URL)
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return nil, fmt.Errorf("invalid loki url %q", opts.URL)
+	}
+	if u.Path == "" || u.Path == "/" {
+		u.Path = lokiPushPath
+	}
+	switch strings.ToLower(opts.Format) {
+	case "":
+		opts.Format = LokiProtobuf
+	case LokiProtobuf, LokiJSON:
+		opts.Format = strings.ToLower(opts.Format)
+	default:
+		return nil, fmt.Errorf("unknown loki format %q, want protobuf or json", opts.Format)
+	}
+	if opts.Labels == nil {
+		opts.Labels = []string{"service", "level", "logger"}
+	}
+	if opts.Client == nil {
+		opts.Client = &http.Client{Timeout: defaultHTTPTimeout}
+	}
+	c := &LokiClient{opts: opts, url: u.String(), labels: map[string]bool{}}
+	for _, l := range opts.Labels {
+		c.labels[l] = true
+	}
+	c.b = newBatcher("loki "+u.Host, opts.Batch, func(entries []lokiEntry) ([]int, error) {
+		return nil, c.push(entries)
+	}, nil)
+	return c, nil
+}
+
+// Sync 立即推送缓存的日志
+func (c *LokiClient) Sync() error {
+	return c.b.sync()
+}
+
+// Close implements io.Closer. 尝试推送剩余日志后退出
+func (c *LokiClient) Close() error {
+	return c.b.close()
+}
+
+// Dropped 缓存已满、超过重试次数或被 Loki 拒绝而丢弃的日志条数
+func (c *LokiClient) Dropped() uint64 {
+	return c.b.dropped.Load()
+}
+
+// push 按 label 分组为 stream 后推送
+func (c *LokiClient) push(entries []lokiEntry) error {
+	var keys []string
+	streams := map[string][]lokiEntry{}
+	for _, e := range entries {
+		if _, ok := streams[e.key]; !ok {
+			keys = append(keys, e.key)
+		}
+		streams[e.key] = append(streams[e.key], e)
+	}
+	var body []byte
+	var contentType string
+	if c.opts.Format == LokiJSON {
+		type stream struct {
+			Stream map[string]string `json:"stream"`
+			Values [][2]string       `json:"values"`
+		}
+		req := struct {
+			Streams []stream `json:"streams"`
+		}{}
+		for _, k := range keys {
+			s := stream{Stream: streams[k][0].labels}
+			for _, e := range streams[k] {
+				s.Values = append(s.Values, [2]string{strconv.FormatInt(e.time.UnixNano(), 10), e.line})
+			}
+			req.Streams = append(req.Streams, s)
+		}
+		data, err := json.Marshal(req)
+		if err != nil {
+			return &permanentError{err: err}
+		}
+		body, contentType = data, "application/json"
+	} else {
+		// logproto.PushRequest{streams: [{labels, entries: [{timestamp, line}]}]}
+		var data []byte
+		for _, k := range keys {
+			var s []byte
+			s = protowire.AppendTag(s, 1, protowire.BytesType)
+			s = protowire.AppendString(s, k)
+			for _, e := range streams[k] {
+				var ts, entry []byte
+				ts = protowire.AppendTag(ts, 1, protowire.VarintType)
+				ts = protowire.AppendVarint(ts, uint64(e.time.Unix()))
+				ts = protowire.AppendTag(ts, 2, protowire.VarintType)
+				ts = protowire.AppendVarint(ts, uint64(e.time.Nanosecond()))
+				entry = protowire.AppendTag(entry, 1, protowire.BytesType)
+				entry = protowire.AppendBytes(entry, ts)
+				entry = protowire.AppendTag(entry, 2, protowire.BytesType)
+				entry = protowire.AppendString(entry, e.line)
+				s = protowire.AppendTag(s, 2, protowire.BytesType)
+				s = protowire.AppendBytes(s, entry)
+			}
+			data = protowire.AppendTag(data, 1, protowire.BytesType)
+			data = protowire.AppendBytes(data, s)
+		}
+		body, contentType = snappy.Encode(nil, data), "application/x-protobuf"
+	}
+	req, err := http.NewRequest(http.MethodPost, c.url, bytes.NewReader(body))
+	if err != nil {
+		return &permanentError{err: err}
+	}
+	for k, v := range c.opts.Header {
+		req.Header[k] = v
+	}
+	req.Header.Set("Content-Type", contentType)
+	if c.opts.TenantID != "" {
+		req.Header.Set("X-Scope-OrgID", c.opts.TenantID)
+	}
+	return postHTTP(c.opts.Client, req)
+}
+
+// lokiCore label 字段从日志中取出作为 stream label，其余字段与 msg caller 等编码为 json 日志行
+type lokiCore struct {
+	zapcore.LevelEnabler
+	c      *LokiClient
+	fields []zapcore.Field
+}
+
+// NewLokiCore 创建 Loki 输出 core，返回的 io.Closer 为 *LokiClient，可通过 Dropped 获取丢弃条数
+func NewLokiCore(opts LokiOptions) (zapcore.Core, io.Closer, error) {
+	c, err := NewLokiClient(opts)
+	if err != nil {
+		return nil, nil, err
+	}
+	return &lokiCore{LevelEnabler: zapcore.DebugLevel, c: c}, c, nil
+}
+
+// With implements zapcore.Core.
+func (c *lokiCore) With(fields []zapcore.Field) zapcore.Core {
+	n := *c
+	n.fields = make([]zapcore.Field, 0, len(c.fields)+len(fields))
+	n.fields = append(n.fields, c.fields...)
+	n.fields = append(n.fields, fields...)
+	return &n
+}
+
+// Check implements zapcore.Core.
+func (c *lokiCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(ent.Level) {
+		return ce.AddCore(ent, c)
+	}
+	return ce
+}
+
+// Write implements zapcore.Core.
+func (c *lokiCore) Write(ent zapcore.Entry, fields []zapcore.Field) error {
+	enc := zapcore.NewMapObjectEncoder()
+	for _, f := range c.fields {
+		f.AddTo(enc)
+	}
+	for _, f := range fields {
+		f.AddTo(enc)
+	}
+	line := enc.Fields
+	line["level"] = ent.Level.String()
+	if ent.LoggerName != "" {
+		line["logger"] = ent.LoggerName
+	}
+	labels := make(map[string]string, len(c.c.opts.StaticLabels)+len(c.c.labels))
+	for k, v := range c.c.opts.StaticLabels {
+		labels[lokiLabelName(k)] = v
+	}
+	for k := range c.c.labels {
+		if v, ok := line[k]; ok {
+			labels[lokiLabelName(k)] = fieldString(v)
+			delete(line, k)
+		}
+	}
+	line["msg"] = ent.Message
+	if ent.Caller.Defined {
+		line["caller"] = ent.Caller.TrimmedPath()
+	}
+	if ent.Stack != "" {
+		line["stack"] = ent.Stack
+	}
+	data, err := json.Marshal(line)
+	if err != nil {
+		return err
+	}
+	e := lokiEntry{key: lokiLabels(labels), labels: labels, time: ent.Time, line: string(data)}
+	c.c.b.post(e, len(e.line)+len(e.key))
+	return nil
+}
+
+// Sync implements zapcore.Core.
+func (c *lokiCore) Sync() error {
+	return c.c.Sync()
+}
+
+// lokiLabels 排序后的 {k="v", ...}
+func lokiLabels(labels map[string]string) string {
+	keys := make([]string, 0, len(labels))
+	for k := range labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var b strings.Builder
+	b.WriteString("{")
+	for i, k := range keys {
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		b.WriteString(k)
+		b.WriteString("=")
+		b.WriteString(strconv.Quote(labels[k]))
+	}
+	b.WriteString("}")
+	return b.String()
+}
+
+// lokiLabelName label 名只允许字母 数字 下划线，不能以数字开头
+func lokiLabelName(s string) string {
+	name := strings.Map(func(r rune) rune {
+		if r == '_' || r >= '0' && r <= '9' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' {
+			return r
+		}
+		return '_'
+	}, s)
+	if name == "" || name[0] >= '0' && name[0] <= '9' {
+		name = "_" + name
+	}
+	return name
+}
+
+// newConfigLokiCore 按 Config 创建 Loki 输出
+func newConfigLokiCore(logConfig Config) (zapcore.Core, io.Closer, error) {
+	opts := LokiOptions{
+		URL:      logConfig.LokiURL,
+		Format:   logConfig.LokiFormat,
+		Labels:   []string{},
+		TenantID: logConfig.LokiTenantID,
+	}
+	for _, l := range strings.Split(logConfig.LokiLabels, ",") {
+		if l = strings.TrimSpace(l); l != "" {
+			opts.Labels = append(opts.Labels, l)
+		}
+	}
+	c, closer, err := NewLokiCore(opts)
+	if err != nil {
+		return nil, nil, fmt.Errorf("loki: %v", err)
+	}
+	return c, closer, nil
+}
@@ -0,0 +1,163 @@
+package zlog
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang/snappy"
+	"go.uber.org/zap/zapcore"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// lokiStream 解码后的 stream，values 为日志行
+type lokiStream struct {
+	labels string
+	lines  []string
+}
+
+// decodeLokiProtobuf 解码 snappy 压缩的 PushRequest
+func decodeLokiProtobuf(t *testing.T, body []byte) []lokiStream {
+	data, err := snappy.Decode(nil, body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fields := func(b []byte, fn func(num protowire.Number, v []byte)) {
+		for len(b) > 0 {
+			num, typ, n := protowire.ConsumeTag(b)
+			b = b[n:]
+			if typ == protowire.BytesType {
+				v, n := protowire.ConsumeBytes(b)
+				fn(num, v)
+				b = b[n:]
+				continue
+			}
+			n = protowire.ConsumeFieldValue(num, typ, b)
+			if n < 0 {
+				t.Fatalf("invalid protobuf")
+			}
+			b = b[n:]
+		}
+	}
+	var streams []lokiStream
+	fields(data, func(_ protowire.Number, sb []byte) {
+		var s lokiStream
+		fields(sb, func(num protowire.Number, v []byte) {
+			if num == 1 {
+				s.labels = string(v)
+				return
+			}
+			fields(v, func(num protowire.Number, v []byte) {
+				if num == 2 {
+					s.lines = append(s.lines, string(v))
+				}
+			})
+		})
+		streams = append(streams, s)
+	})
+	return streams
+}
+
+func TestLokiProtobuf(t *testing.T) {
+	var mu sync.Mutex
+	var streams []lokiStream
+	var calls int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		calls++
+		if calls == 1 {
+			// 第一次失败，重试后成功
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		if r.URL.Path != lokiPushPath || r.Header.Get("Content-Type") != "application/x-protobuf" || r.Header.Get("X-Scope-OrgID") != "team" {
+			t.Errorf("unexpected request %s %v", r.URL.Path, r.Header)
+		}
+		body, _ := io.ReadAll(r.Body)
+		streams = append(streams, decodeLokiProtobuf(t, body)...)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+	logger, err := New(WithService("app"), WithLoki(LokiOptions{URL: srv.URL, TenantID: "team",
+		StaticLabels: map[string]string{"env": "test"},
+		Batch:        BatchOptions{BatchSize: 3, FlushInterval: time.Hour, MinBackoff: 10 * time.Millisecond}}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer logger.Close(context.Background())
+	logger.Named("db").WithField("uid", 7).Info("first")
+	logger.Info("second")
+	logger.Error("third")
+
+	for i := 0; i < 100; i++ {
+		mu.Lock()
+		n := len(streams)
+		mu.Unlock()
+		if n > 0 {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	want := map[string]int{
+		`{env="test", level="info", logger="db", service="app"}`: 1,
+		`{env="test", level="info", service="app"}`:              1,
+		`{env="test", level="error", service="app"}`:             1,
+	}
+	if len(streams) != len(want) || calls != 2 {
+		t.Fatalf("unexpected streams %v after %d calls", streams, calls)
+	}
+	for _, s := range streams {
+		if want[s.labels] != len(s.lines) {
+			t.Fatalf("unexpected stream %v", s)
+		}
+	}
+	var line map[string]interface{}
+	if err := json.Unmarshal([]byte(streams[0].lines[0]), &line); err != nil {
+		t.Fatal(err)
+	}
+	if line["msg"] != "first" || line["uid"] != float64(7) || line["caller"] == nil || line["service"] != nil {
+		t.Fatalf("unexpected line %v", line)
+	}
+}
+
+func TestLokiJSONDropped(t *testing.T) {
+	var mu sync.Mutex
+	var bodies []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		bodies = append(bodies, string(body))
+		mu.Unlock()
+		// 4xx 不重试，该批丢弃
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer srv.Close()
+	core, closer, err := NewLokiCore(LokiOptions{URL: srv.URL + "/custom/push", Format: LokiJSON, Labels: []string{"level"},
+		Batch: BatchOptions{FlushInterval: time.Hour}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer closer.Close()
+	ent := zapcore.Entry{Level: zapcore.WarnLevel, Time: time.Unix(1, 5), Message: "hello"}
+	if err := core.Write(ent, nil); err != nil {
+		t.Fatal(err)
+	}
+	_ = core.Sync()
+	mu.Lock()
+	defer mu.Unlock()
+	want := `{"streams":[{"stream":{"level":"warn"},"values":[["1000000005","{\"msg\":\"hello\"}"]]}]}`
+	if len(bodies) != 1 || bodies[0] != want {
+		t.Fatalf("unexpected bodies %q", bodies)
+	}
+	if d := closer.(*LokiClient).Dropped(); d != 1 {
+		t.Fatalf("dropped %d, want 1", d)
+	}
+}
@@ -0,0 +1,237 @@
+// @Author: openownworld
+// @Email:  openownworld@163.com
+// @File:   named.go
+// @Description: 分层命名 logger，按名称前缀覆盖日志级别
+
+package zlog
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// maxLoggerNames 最多记录的命名 logger 名称数，按请求或租户动态命名时避免无限增长
+const maxLoggerNames = 1024
+
+// levelRegistry 命名 logger 级别注册表，按最长前缀匹配，每个根 logger 一个，With Named 派生的子 logger 共享
+type levelRegistry struct {
+	mu        sync.RWMutex
+	overrides map[string]zapcore.Level // 前缀 -> 覆盖级别
+	names     map[string]struct{}      // 已创建过的命名 logger，最多 maxLoggerNames 个
+}
+
+func newLevelRegistry() *levelRegistry {
+	return &levelRegistry{
+		overrides: map[string]zapcore.Level{},
+		names:     map[string]struct{}{},
+	}
+}
+
+// resolve 按最长前缀匹配 payments.gateway -> payments.gateway, payments
+func (r *levelRegistry) resolve(name string) (zapcore.Level, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if len(r.overrides) == 0 {
+		return zapcore.DebugLevel, false
+	}
+	for {
+		if lvl, ok := r.overrides[name]; ok {
+			return lvl, true
+		}
+		i := strings.LastIndexByte(name, '.')
+		if i < 0 {
+			return zapcore.DebugLevel, false
+		}
+		name = name[:i]
+	}
+}
+
+func (r *levelRegistry) set(prefix string, lvl zapcore.Level) {
+	r.mu.Lock()
+	r.overrides[prefix] = lvl
+	r.mu.Unlock()
+}
+
+func (r *levelRegistry) reset(prefix string) {
+	r.mu.Lock()
+	delete(r.overrides, prefix)
+	r.mu.Unlock()
+}
+
+// register 记录命名 logger 名称，超过 maxLoggerNames 后不再记录
+func (r *levelRegistry) register(name string) {
+	r.mu.Lock()
+	r.addName(name)
+	r.mu.Unlock()
+}
+
+// addName 调用方持有锁
+func (r *levelRegistry) addName(name string) {
+	if _, ok := r.names[name]; ok || len(r.names) >= maxLoggerNames {
+		return
+	}
+	r.names[name] = struct{}{}
+}
+
+// merge 并入 from 的命名 logger 以及未设置的前缀级别覆盖
+func (r *levelRegistry) merge(from *levelRegistry) {
+	if r == from {
+		return
+	}
+	from.mu.RLock()
+	defer from.mu.RUnlock()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for name := range from.names {
+		r.addName(name)
+	}
+	for prefix, lvl := range from.overrides {
+		if _, ok := r.overrides[prefix]; !ok {
+			r.overrides[prefix] = lvl
+		}
+	}
+}
+
+// snapshot 返回所有前缀级别覆盖
+func (r *levelRegistry) snapshot() map[string]Level {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	m := make(map[string]Level, len(r.overrides))
+	for prefix, lvl := range r.overrides {
+		m[prefix] = zapLevelToLevel[lvl]
+	}
+	return m
+}
+
+// namedLevel 命名 logger 的级别，有前缀覆盖时用覆盖级别，否则跟随根 logger，name 为空即根 logger
+type namedLevel struct {
+	name string
+	h    *coreHolder
+}
+
+// Level returns the effective level of the named logger.
+func (n namedLevel) Level() zapcore.Level {
+	h := n.h.resolve()
+	if n.name == "" {
+		return h.level.Level()
+	}
+	if lvl, ok := h.levels.resolve(n.name); ok {
+		return lvl
+	}
+	return h.level.Level()
+}
+
+// Enabled implements zapcore.LevelEnabler.
+func (n namedLevel) Enabled(lvl zapcore.Level) bool {
+	return lvl >= n.Level()
+}
+
+// levelCore 在 tee 外层按 logger 自己的级别过滤，内层 core 不再各自持有级别
+type levelCore struct {
+	zapcore.Core
+	level zapcore.LevelEnabler
+}
+
+// Enabled implements zapcore.Core.
+func (c *levelCore) Enabled(lvl zapcore.Level) bool {
+	return c.level.Enabled(lvl) && c.Core.Enabled(lvl)
+}
+
+// With implements zapcore.Core.
+func (c *levelCore) With(fields []zapcore.Field) zapcore.Core {
+	return &levelCore{Core: c.Core.With(fields), level: c.level}
+}
+
+// Check implements zapcore.Core.
+func (c *levelCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if !c.level.Enabled(ent.Level) {
+		return ce
+	}
+	return c.Core.Check(ent, ce)
+}
+
+// withLevel 替换 logger 外层 levelCore 的级别
+func withLevel(logger *zap.Logger, level zapcore.LevelEnabler) *zap.Logger {
+	return logger.WithOptions(zap.WrapCore(func(core zapcore.Core) zapcore.Core {
+		if c, ok := core.(*levelCore); ok {
+			return &levelCore{Core: c.Core, level: level}
+		}
+		return &levelCore{Core: core, level: level}
+	}))
+}
+
+// Named returns a named child of the default logger, e.g. Named("payments.gateway").
+func Named(name string) Logger {
+	return GetDefaultLogger().Named(name)
+}
+
+// defaultLevels 默认 logger 的命名级别注册表，默认 logger 不是 zLogger 时返回空注册表
+func defaultLevels() *levelRegistry {
+	if z, ok := unwrapZLogger(GetDefaultLogger()); ok {
+		return z.h.resolve().levels
+	}
+	return newLevelRegistry()
+}
+
+// SetNamedLevel 设置默认 logger 的前缀级别覆盖，payments 覆盖 payments.gateway 等所有子 logger
+func SetNamedLevel(prefix string, level Level) {
+	v, ok := levelToZapLevel[level]
+	if !ok {
+		return
+	}
+	defaultLevels().set(prefix, v)
+}
+
+// ResetNamedLevel 删除默认 logger 的前缀级别覆盖，之后跟随上一级前缀或根 logger
+func ResetNamedLevel(prefix string) {
+	defaultLevels().reset(prefix)
+}
+
+// SetNamedLevels 默认 logger 按 "payments=warn,payments.gateway=debug" 格式批量设置前缀级别覆盖
+func SetNamedLevels(spec string) error {
+	overrides := map[string]zapcore.Level{}
+	for _, item := range strings.Split(spec, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		kv := strings.SplitN(item, "=", 2)
+		if len(kv) != 2 || strings.TrimSpace(kv[0]) == "" {
+			return fmt.Errorf("invalid named level %q, want name=level", item)
+		}
+		lvl, ok := LevelNames[strings.ToLower(strings.TrimSpace(kv[1]))]
+		if !ok {
+			return fmt.Errorf("invalid named level %q, unknown level %q", item, kv[1])
+		}
+		overrides[strings.TrimSpace(kv[0])] = levelToZapLevel[lvl]
+	}
+	levels := defaultLevels()
+	for prefix, lvl := range overrides {
+		levels.set(prefix, lvl)
+	}
+	return nil
+}
+
+// NamedLevels 返回默认 logger 当前所有前缀级别覆盖
+func NamedLevels() map[string]Level {
+	return defaultLevels().snapshot()
+}
+
+// LoggerNames 返回默认 logger 已创建过的命名 logger 名称，按字母排序
+// 尽力而为，最多记录 1024 个名称，之后新创建的名称不再列出，级别覆盖仍然生效
+func LoggerNames() []string {
+	levels := defaultLevels()
+	levels.mu.RLock()
+	names := make([]string, 0, len(levels.names))
+	for name := range levels.names {
+		names = append(names, name)
+	}
+	levels.mu.RUnlock()
+	sort.Strings(names)
+	return names
+}
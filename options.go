@@ -0,0 +1,432 @@
+// @Author: openownworld
+// @Email:  openownworld@163.com
+// @File:   options.go
+// @Description: 函数式选项创建 logger，支持多个文件、socket 输出和自定义 core
+
+package zlog
+
+import (
+	"errors"
+	"fmt"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// Rotation 文件切割与保留策略
+type Rotation struct {
+	MaxSize    int    // Mb 最大文件限制，按时间切割时为周期内单个文件的限制
+	MaxBackups int    // 最大文件数限制
+	MaxDays    int    // 最大天数保存
+	Compress   bool   // 启用日志压缩
+	Period     string // 切割周期 size hourly daily，默认 size 只按大小切割
+}
+
+// DefaultRotation 与 GetDefaultConfig 一致的切割策略
+func DefaultRotation() Rotation {
+	return Rotation{MaxSize: 20, MaxBackups: 15, MaxDays: 15, Compress: true}
+}
+
+// Option 创建 logger 的选项
+type Option func(*options)
+
+// SinkOption 单个输出的选项
+type SinkOption func(*sinkOptions)
+
+type options struct {
+	config     Config // level stacktraceLevel shortCaller functionEnable serviceName
+	callerSkip int
+	fields     []Field
+	sinks      []func(o *options, out *outputs) (zapcore.Core, error)
+	disk       *DiskLimit
+	errs       []error
+}
+
+type sinkOptions struct {
+	format string
+	level  zapcore.Level
+	stream StreamOptions
+	async  *AsyncOptions
+}
+
+// SinkFormat 输出格式 console json
+func SinkFormat(format string) SinkOption {
+	return func(o *sinkOptions) {
+		o.format = format
+	}
+}
+
+// SinkLevel 该输出的最低级别，如 error 级别的错误日志文件
+func SinkLevel(level Level) SinkOption {
+	return func(o *sinkOptions) {
+		o.level = levelToZapLevel[level]
+	}
+}
+
+// SinkStream tcp 等流式 socket 输出的分帧、缓存和重连选项
+func SinkStream(stream StreamOptions) SinkOption {
+	return func(o *sinkOptions) {
+		o.stream = stream
+	}
+}
+
+// SinkAsync 异步写入，调用方只编码日志并放入队列，不等待磁盘或网络
+func SinkAsync(async AsyncOptions) SinkOption {
+	return func(o *sinkOptions) {
+		o.async = &async
+	}
+}
+
+// WithDiskLimit 限制所有 WithFile 文件及其备份的总大小和磁盘剩余空间
+func WithDiskLimit(limit DiskLimit) Option {
+	return func(o *options) {
+		o.disk = &limit
+	}
+}
+
+// WithLevel 日志级别，默认 debug
+func WithLevel(level Level) Option {
+	return func(o *options) {
+		if _, ok := levelToZapLevel[level]; !ok {
+			o.errs = append(o.errs, fmt.Errorf("WithLevel: unknown level %d", level))
+			return
+		}
+		o.config.Level = LevelStrings[level]
+	}
+}
+
+// WithStacktraceLevel 输出调用堆栈 级别，默认 panic
+func WithStacktraceLevel(level Level) Option {
+	return func(o *options) {
+		if _, ok := levelToZapLevel[level]; !ok {
+			o.errs = append(o.errs, fmt.Errorf("WithStacktraceLevel: unknown level %d", level))
+			return
+		}
+		o.config.StacktraceLevel = LevelStrings[level]
+	}
+}
+
+// WithCaller 文件名行号 短路径或全路径，是否输出函数路径
+func WithCaller(shortCaller, function bool) Option {
+	return func(o *options) {
+		o.config.ShortCaller = shortCaller
+		o.config.FunctionEnable = function
+	}
+}
+
+// WithCallerSkip 在默认层数上额外跳过 n 层调用栈，用于再次封装 zlog
+func WithCallerSkip(n int) Option {
+	return func(o *options) {
+		o.callerSkip += n
+	}
+}
+
+// WithService 每条日志带上 service 字段
+func WithService(name string) Option {
+	return func(o *options) {
+		o.config.ServiceName = name
+	}
+}
+
+// WithBaseFields 每条日志带上的公共字段
+func WithBaseFields(fields ...Field) Option {
+	return func(o *options) {
+		o.fields = append(o.fields, fields...)
+	}
+}
+
+// WithConsole 输出到终端 format 为 console(彩色) 或 json
+func WithConsole(format string, opts ...SinkOption) Option {
+	return addSink(append([]SinkOption{SinkFormat(format)}, opts...),
+		func(o *options, so sinkOptions, out *outputs) (zapcore.Core, error) {
+			enc, err := sinkEncoder(o, so, true)
+			if err != nil {
+				return nil, fmt.Errorf("WithConsole: %v", err)
+			}
+			c, err := newSinkCore("console", enc, stdoutWriter(), so.level, so.async, out)
+			if err != nil {
+				return nil, fmt.Errorf("WithConsole: %v", err)
+			}
+			return c, nil
+		})
+}
+
+// WithFile 输出到文件，可多次使用输出到多个文件
+func WithFile(path string, rotation Rotation, opts ...SinkOption) Option {
+	return addSink(opts, func(o *options, so sinkOptions, out *outputs) (zapcore.Core, error) {
+		if path == "" {
+			return nil, errors.New("WithFile: path is required")
+		}
+		enc, err := sinkEncoder(o, so, false)
+		if err != nil {
+			return nil, fmt.Errorf("WithFile %s: %v", path, err)
+		}
+		hook, err := newRotateFile(path, rotation)
+		if err != nil {
+			return nil, fmt.Errorf("WithFile %s: %v", path, err)
+		}
+		c, err := newSinkCore(path, enc, zapcore.AddSync(out.addFile(hook)), so.level, so.async, out)
+		if err != nil {
+			return nil, fmt.Errorf("WithFile %s: %v", path, err)
+		}
+		if o.disk != nil {
+			c = out.limitDisk(*o.disk, path, hook, c)
+		}
+		return c, nil
+	})
+}
+
+// WithSocket 输出到 socket，network 为 udp tcp tls unix unixgram，unix 类型 addr 为 socket 路径，可多次使用输出到多个地址
+func WithSocket(network, addr string, opts ...SinkOption) Option {
+	return addSink(opts, func(o *options, so sinkOptions, out *outputs) (zapcore.Core, error) {
+		if !socketTypes[network] || network == "" {
+			return nil, fmt.Errorf("WithSocket: unsupported socket type %q", network)
+		}
+		enc, err := sinkEncoder(o, so, false)
+		if err != nil {
+			return nil, fmt.Errorf("WithSocket %s: %v", addr, err)
+		}
+		conn, err := newSocketWriter(network, addr, so.stream)
+		if err != nil {
+			return nil, fmt.Errorf("WithSocket: dial %s socket %s failed: %v", network, addr, err)
+		}
+		out.closers = append(out.closers, conn)
+		c, err := newSinkCore(network+" "+addr, enc, zapcore.AddSync(conn), so.level, so.async, out)
+		if err != nil {
+			return nil, fmt.Errorf("WithSocket %s: %v", addr, err)
+		}
+		return c, nil
+	})
+}
+
+// WithSyslog 输出到 syslog
+func WithSyslog(opts SyslogOptions) Option {
+	return func(o *options) {
+		o.sinks = append(o.sinks, func(o *options, out *outputs) (zapcore.Core, error) {
+			if opts.AppName == "" {
+				opts.AppName = o.config.ServiceName
+			}
+			c, closer, err := NewSyslogCore(opts)
+			if err != nil {
+				return nil, fmt.Errorf("WithSyslog: %v", err)
+			}
+			out.closers = append(out.closers, closer)
+			return c, nil
+		})
+	}
+}
+
+// WithGELF 输出到 Graylog GELF input
+func WithGELF(opts GELFOptions) Option {
+	return func(o *options) {
+		o.sinks = append(o.sinks, func(o *options, out *outputs) (zapcore.Core, error) {
+			c, closer, err := NewGELFCore(opts)
+			if err != nil {
+				return nil, fmt.Errorf("WithGELF: %v", err)
+			}
+			out.closers = append(out.closers, closer)
+			return c, nil
+		})
+	}
+}
+
+// WithFluent 输出到 Fluentd / Fluent Bit forward input，tag 默认 WithService 的服务名
+func WithFluent(opts FluentOptions) Option {
+	return func(o *options) {
+		o.sinks = append(o.sinks, func(o *options, out *outputs) (zapcore.Core, error) {
+			if opts.Tag == "" {
+				opts.Tag = o.config.ServiceName
+			}
+			c, closer, err := NewFluentCore(opts)
+			if err != nil {
+				return nil, fmt.Errorf("WithFluent: %v", err)
+			}
+			out.closers = append(out.closers, closer)
+			return c, nil
+		})
+	}
+}
+
+// WithLoki 推送到 Grafana Loki
+func WithLoki(opts LokiOptions) Option {
+	return func(o *options) {
+		o.sinks = append(o.sinks, func(o *options, out *outputs) (zapcore.Core, error) {
+			c, closer, err := NewLokiCore(opts)
+			if err != nil {
+				return nil, fmt.Errorf("WithLoki: %v", err)
+			}
+			out.closers = append(out.closers, closer)
+			return c, nil
+		})
+	}
+}
+
+// WithElastic 通过 _bulk 写入 Elasticsearch / OpenSearch，使用 json 编码器
+func WithElastic(opts ElasticOptions) Option {
+	return func(o *options) {
+		o.sinks = append(o.sinks, func(o *options, out *outputs) (zapcore.Core, error) {
+			enc := newEncoder(EncoderOption{formatter: "json", timeFmt: "rfc3339", shortCaller: o.config.ShortCaller, function: o.config.FunctionEnable})
+			c, closer, err := NewElasticCore(opts, enc)
+			if err != nil {
+				return nil, fmt.Errorf("WithElastic: %v", err)
+			}
+			out.closers = append(out.closers, closer)
+			return c, nil
+		})
+	}
+}
+
+// WithKafka 写入 kafka topic，使用 json 编码器
+func WithKafka(opts KafkaOptions) Option {
+	return func(o *options) {
+		o.sinks = append(o.sinks, func(o *options, out *outputs) (zapcore.Core, error) {
+			enc := newEncoder(EncoderOption{formatter: "json", timeFmt: "rfc3339", shortCaller: o.config.ShortCaller, function: o.config.FunctionEnable})
+			c, closer, err := NewKafkaCore(opts, enc)
+			if err != nil {
+				return nil, fmt.Errorf("WithKafka: %v", err)
+			}
+			out.closers = append(out.closers, closer)
+			return c, nil
+		})
+	}
+}
+
+// WithWebhook 分批 POST 到 http webhook，使用 json 编码器，如 Level 为 LevelError 时发送告警
+func WithWebhook(opts WebhookOptions) Option {
+	return func(o *options) {
+		o.sinks = append(o.sinks, func(o *options, out *outputs) (zapcore.Core, error) {
+			enc := newEncoder(EncoderOption{formatter: "json", timeFmt: "rfc3339", shortCaller: o.config.ShortCaller, function: o.config.FunctionEnable})
+			c, closer, err := NewWebhookCore(opts, enc)
+			if err != nil {
+				return nil, fmt.Errorf("WithWebhook: %v", err)
+			}
+			out.closers = append(out.closers, closer)
+			return c, nil
+		})
+	}
+}
+
+// WithOTLP 导出到 OpenTelemetry Collector，service.name 默认 WithService 的服务名
+func WithOTLP(opts OTLPOptions) Option {
+	return func(o *options) {
+		o.sinks = append(o.sinks, func(o *options, out *outputs) (zapcore.Core, error) {
+			if opts.ServiceName == "" {
+				opts.ServiceName = o.config.ServiceName
+			}
+			c, closer, err := NewOTLPCore(opts)
+			if err != nil {
+				return nil, fmt.Errorf("WithOTLP: %v", err)
+			}
+			out.closers = append(out.closers, closer)
+			return c, nil
+		})
+	}
+}
+
+// WithJournal 输出到 systemd-journald，只支持 linux
+func WithJournal(opts JournalOptions) Option {
+	return func(o *options) {
+		o.sinks = append(o.sinks, func(o *options, out *outputs) (zapcore.Core, error) {
+			if opts.SyslogIdentifier == "" {
+				opts.SyslogIdentifier = o.config.ServiceName
+			}
+			c, closer, err := NewJournalCore(opts)
+			if err != nil {
+				return nil, fmt.Errorf("WithJournal: %v", err)
+			}
+			out.closers = append(out.closers, closer)
+			return c, nil
+		})
+	}
+}
+
+// WithSink 自定义输出 core，级别过滤仍由 logger 统一处理
+func WithSink(core zapcore.Core) Option {
+	return func(o *options) {
+		if core == nil {
+			o.errs = append(o.errs, errors.New("WithSink: core is nil"))
+			return
+		}
+		o.sinks = append(o.sinks, func(*options, *outputs) (zapcore.Core, error) {
+			return core, nil
+		})
+	}
+}
+
+func addSink(opts []SinkOption, build func(o *options, so sinkOptions, out *outputs) (zapcore.Core, error)) Option {
+	so := sinkOptions{format: "console", level: zapcore.DebugLevel}
+	for _, opt := range opts {
+		opt(&so)
+	}
+	return func(o *options) {
+		o.sinks = append(o.sinks, func(o *options, out *outputs) (zapcore.Core, error) {
+			return build(o, so, out)
+		})
+	}
+}
+
+func sinkEncoder(o *options, so sinkOptions, console bool) (zapcore.Encoder, error) {
+	op := EncoderOption{timeFmt: configTimeFmt(o.config), shortCaller: o.config.ShortCaller, function: o.config.FunctionEnable}
+	switch so.format {
+	case "", "console":
+		op.colorLevel = console
+	case "json":
+		op.formatter = "json"
+	default:
+		return nil, fmt.Errorf("unknown format %q", so.format)
+	}
+	return newEncoder(op), nil
+}
+
+// New 按选项创建 logger，未指定输出时输出到终端
+// 通过 SetDefaultLogger 设置为默认 logger 并使用包函数 zlog.Info 时，需 WithCallerSkip(1)
+//
+//	logger, err := zlog.New(
+//		zlog.WithLevel(zlog.LevelInfo),
+//		zlog.WithConsole("console"),
+//		zlog.WithFile("./logs/log.log", zlog.DefaultRotation(), zlog.SinkFormat("json")),
+//		zlog.WithFile("./logs/error.log", zlog.DefaultRotation(), zlog.SinkLevel(zlog.LevelError)),
+//	)
+func New(opts ...Option) (Logger, error) {
+	o := &options{
+		config: Config{Level: "debug", StacktraceLevel: "panic", ShortCaller: true},
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+	if len(o.sinks) == 0 {
+		WithConsole("console")(o)
+	}
+	out := &outputs{}
+	cores := make([]zapcore.Core, 0, len(o.sinks))
+	for _, build := range o.sinks {
+		core, err := build(o, out)
+		if err != nil {
+			o.errs = append(o.errs, err)
+			continue
+		}
+		cores = append(cores, core)
+	}
+	if err := errors.Join(o.errs...); err != nil {
+		_ = out.close()
+		return nil, err
+	}
+	if out.disk != nil {
+		out.disk.start()
+	}
+	core := zapcore.NewTee(cores...)
+	if o.config.ServiceName != "" {
+		core = core.With([]zapcore.Field{zap.String("service", o.config.ServiceName)})
+	}
+	fields := make([]zap.Field, len(o.fields))
+	for i, f := range o.fields {
+		fields[i] = zap.Any(f.Key, f.Value)
+	}
+	h := newCoreHolder(o.config, core, out)
+	// 直接调用 logger 方法比包函数少一层，与 With 一样用 zLogWrapper 补上
+	return &zLogWrapper{logger: &zLogger{
+		logger:      newZapLogger(h, callerSkipNum+o.callerSkip, zap.Fields(fields...)),
+		h:           h,
+		shortCaller: o.config.ShortCaller,
+	}}, nil
+}
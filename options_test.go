@@ -0,0 +1,161 @@
+package zlog
+
+import (
+	"context"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+	"gopkg.in/natefinch/lumberjack.v2"
+)
+
+func TestNewOptions(t *testing.T) {
+	dir := t.TempDir()
+	core, logs := observer.New(zapcore.DebugLevel)
+	logger, err := New(
+		WithLevel(LevelInfo),
+		WithService("app"),
+		WithBaseFields(Field{Key: "region", Value: "cn"}),
+		WithSink(core),
+		WithFile(filepath.Join(dir, "all.log"), DefaultRotation(), SinkFormat("json")),
+		WithFile(filepath.Join(dir, "error.log"), DefaultRotation(), SinkLevel(LevelError)),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	logger.Debug("drop")
+	logger.Info("info")
+	logger.WithField("k", "v").Error("error")
+	if logs.Len() != 2 {
+		t.Fatalf("observed %d entries", logs.Len())
+	}
+	ctx := logs.All()[1].ContextMap()
+	if ctx["service"] != "app" || ctx["region"] != "cn" || ctx["k"] != "v" {
+		t.Fatalf("unexpected fields %v", ctx)
+	}
+	if !strings.HasSuffix(logs.All()[0].Caller.File, "options_test.go") {
+		t.Fatalf("unexpected caller %v", logs.All()[0].Caller)
+	}
+	all, _ := os.ReadFile(filepath.Join(dir, "all.log"))
+	errs, _ := os.ReadFile(filepath.Join(dir, "error.log"))
+	if !strings.Contains(string(all), `"msg":"info"`) || strings.Contains(string(errs), "info") || !strings.Contains(string(errs), "error") {
+		t.Fatalf("unexpected files:\n%s\n%s", all, errs)
+	}
+
+	if _, err := New(WithConsole("xml"), WithFile("", Rotation{}), WithSocket("sctp", "127.0.0.1:1")); err == nil ||
+		!strings.Contains(err.Error(), "WithConsole") || !strings.Contains(err.Error(), "WithFile") || !strings.Contains(err.Error(), "WithSocket") {
+		t.Fatalf("expect option errors, got %v", err)
+	}
+}
+
+func TestLoggerClose(t *testing.T) {
+	dir := t.TempDir()
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	logger, err := New(WithFile(filepath.Join(dir, "a.log"), Rotation{}), WithSocket("udp", conn.LocalAddr().String()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	child := logger.WithField("k", "v")
+	logger.Info("before close")
+	if err := logger.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	child.Info("after close")
+	data, _ := os.ReadFile(filepath.Join(dir, "a.log"))
+	if !strings.Contains(string(data), "before close") || strings.Contains(string(data), "after close") {
+		t.Fatalf("unexpected file: %s", data)
+	}
+	z, _ := unwrapZLogger(logger)
+	if len(z.h.load().out.closers) != 0 {
+		t.Fatal("outputs not released")
+	}
+
+	cfg := GetDefaultConfig()
+	cfg.ConsoleLogger = false
+	cfg.LogFileName = filepath.Join(dir, "b.log")
+	if err := InitLog(cfg); err != nil {
+		t.Fatal(err)
+	}
+	old := GetDefaultLogger()
+	SetDefaultLogger(old.WithField("k", "v"))
+	old.Info("shared outputs kept")
+	InitLog(GetDefaultConfig())
+	old.Info("after replace")
+	data, _ = os.ReadFile(cfg.LogFileName)
+	if !strings.Contains(string(data), "shared outputs kept") || strings.Contains(string(data), "after replace") {
+		t.Fatalf("unexpected file: %s", data)
+	}
+}
+
+func TestReplacedDefaultForwards(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("ZLOG_LOGFILENAME", filepath.Join(dir, "lazy.log"))
+	t.Setenv("ZLOG_CONSOLELOGGER", "false")
+	mtx.Lock()
+	defaultLogger, defaultLazy = nil, false
+	mtx.Unlock()
+	defer InitLog(GetDefaultConfig())
+	// 未初始化时派生的 logger 跟随 InitLog 创建的默认 logger
+	named := Named("x")
+	child := GetDefaultLogger().WithField("k", "v")
+	cfg := GetDefaultConfig()
+	cfg.ConsoleLogger = false
+	cfg.LogFileName = filepath.Join(dir, "b.log")
+	cfg.Level = "info"
+	if err := InitLog(cfg); err != nil {
+		t.Fatal(err)
+	}
+	named.Info("named after replace")
+	named.Debug("debug after replace")
+	child.Info("child after replace")
+	data, _ := os.ReadFile(cfg.LogFileName)
+	if !strings.Contains(string(data), "named after replace") || !strings.Contains(string(data), "child after replace") ||
+		strings.Contains(string(data), "debug after replace") {
+		t.Fatalf("unexpected file: %s", data)
+	}
+	if names := strings.Join(LoggerNames(), ","); !strings.Contains(","+names+",", ",x,") {
+		t.Fatalf("logger names %v", names)
+	}
+	// 用户创建的 logger 被替换后不转发
+	cfg.LogFileName = filepath.Join(dir, "user.log")
+	user := NewZLogger(cfg)
+	SetDefaultLogger(user)
+	userChild := user.Named("u")
+	cfg.LogFileName = filepath.Join(dir, "c.log")
+	if err := InitLog(cfg); err != nil {
+		t.Fatal(err)
+	}
+	userChild.Info("user after replace")
+	data, _ = os.ReadFile(cfg.LogFileName)
+	if strings.Contains(string(data), "user after replace") {
+		t.Fatalf("user logger forwarded: %s", data)
+	}
+}
+
+func TestOutputFileClosed(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "closed.log")
+	out := &outputs{}
+	f := out.addFile(&lumberjack.Logger{Filename: path})
+	if _, err := f.Write([]byte("a\n")); err != nil {
+		t.Fatal(err)
+	}
+	if err := out.close(); err != nil {
+		t.Fatal(err)
+	}
+	_ = os.Remove(path)
+	if _, err := f.Write([]byte("b\n")); !errors.Is(err, os.ErrClosed) {
+		t.Fatalf("write after close: %v", err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Fatalf("file reopened after close: %v", err)
+	}
+}
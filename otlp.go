@@ -0,0 +1,459 @@
+// @Author: openownworld
+// @Email:  openownworld@163.com
+// @File:   otlp.go
+// @Description: OpenTelemetry OTLP/HTTP logs 输出，protobuf 或 json 编码
+
+package zlog
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.uber.org/zap/zapcore"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// Enums OTLP encoding constants.
+const (
+	OTLPProtobuf = "protobuf"
+	OTLPJSON     = "json"
+)
+
+const otlpLogsPath = "/v1/logs"
+
+// otlpSeverities zap 级别对应的 OTLP SeverityNumber
+var otlpSeverities = map[zapcore.Level]int{
+	zapcore.DebugLevel:  5,  // DEBUG
+	zapcore.InfoLevel:   9,  // INFO
+	zapcore.WarnLevel:   13, // WARN
+	zapcore.ErrorLevel:  17, // ERROR
+	zapcore.DPanicLevel: 21, // FATAL
+	zapcore.PanicLevel:  22, // FATAL2
+	zapcore.FatalLevel:  23, // FATAL3
+}
+
+// OTLPOptions OTLP/HTTP logs 输出选项
+type OTLPOptions struct {
+	Endpoint           string                 // collector 地址 http://127.0.0.1:4318，没有路径时使用 /v1/logs
+	Encoding           string                 // protobuf json，默认 protobuf
+	ServiceName        string                 // resource 属性 service.name
+	ResourceAttributes map[string]interface{} // 其他 resource 属性，如 deployment.environment
+	Header             http.Header            // 额外的请求头，如 Authorization
+	Client             *http.Client           // 默认超时 10s 的 http.Client
+	Batch              BatchOptions           // 分批、缓存与重试
+}
+
+// otlpKeyValue 属性，value 为 string bool int64 float64 []interface{} map[string]interface{}
+type otlpKeyValue struct {
+	key   string
+	value interface{}
+}
+
+// otlpRecord 一条 LogRecord
+type otlpRecord struct {
+	time     time.Time
+	observed time.Time
+	severity int
+	text     string
+	body     string
+	attrs    []otlpKeyValue
+	traceID  []byte
+	spanID   []byte
+}
+
+// OTLPExporter 分批导出 LogRecord 到 OpenTelemetry Collector
+type OTLPExporter struct {
+	opts     OTLPOptions
+	url      string
+	resource []otlpKeyValue
+	b        *batcher[otlpRecord]
+}
+
+// NewOTLPExporter 创建 OTLP/HTTP logs 输出
+func NewOTLPExporter(opts OTLPOptions) (*OTLPExporter, error) {
+	u, err := url.Parse(opts.Endpoint)
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return nil, fmt.Errorf("invalid otlp endpoint %q", opts.Endpoint)
+	}
+	if u.Path == "" || u.Path == "/" {
+		u.Path = otlpLogsPath
+	}
+	switch strings.ToLower(opts.Encoding) {
+	case "":
+		opts.Encoding = OTLPProtobuf
+	case OTLPProtobuf, OTLPJSON:
+		opts.Encoding = strings.ToLower(opts.Encoding)
+	default:
+		return nil, fmt.Errorf("unknown otlp encoding %q, want protobuf or json", opts.Encoding)
+	}
+	if opts.Client == nil {
+		opts.Client = &http.Client{Timeout: defaultHTTPTimeout}
+	}
+	e := &OTLPExporter{opts: opts, url: u.String()}
+	attrs := map[string]interface{}{}
+	for k, v := range opts.ResourceAttributes {
+		attrs[k] = v
+	}
+	if opts.ServiceName != "" {
+		attrs["service.name"] = opts.ServiceName
+	}
+	if _, ok := attrs["host.name"]; !ok {
+		if host, err := os.Hostname(); err == nil {
+			attrs["host.name"] = host
+		}
+	}
+	e.resource = otlpAttributes(attrs)
+	e.b = newBatcher("otlp "+u.Host, opts.Batch, func(records []otlpRecord) ([]int, error) {
+		return nil, e.export(records)
+	}, nil)
+	return e, nil
+}
+
+// Sync 立即导出缓存的日志
+func (e *OTLPExporter) Sync() error {
+	return e.b.sync()
+}
+
+// Close implements io.Closer. 尝试导出剩余日志后退出
+func (e *OTLPExporter) Close() error {
+	return e.b.close()
+}
+
+// Dropped 缓存已满、超过重试次数或被拒绝而丢弃的日志条数
+func (e *OTLPExporter) Dropped() uint64 {
+	return e.b.dropped.Load()
+}
+
+func (e *OTLPExporter) export(records []otlpRecord) error {
+	var body []byte
+	var contentType string
+	if e.opts.Encoding == OTLPJSON {
+		data, err := json.Marshal(e.jsonRequest(records))
+		if err != nil {
+			return &permanentError{err: err}
+		}
+		body, contentType = data, "application/json"
+	} else {
+		body, contentType = e.protoRequest(records), "application/x-protobuf"
+	}
+	req, err := http.NewRequest(http.MethodPost, e.url, bytes.NewReader(body))
+	if err != nil {
+		return &permanentError{err: err}
+	}
+	for k, v := range e.opts.Header {
+		req.Header[k] = v
+	}
+	req.Header.Set("Content-Type", contentType)
+	return postHTTP(e.opts.Client, req)
+}
+
+// protoRequest ExportLogsServiceRequest{resource_logs: [{resource, scope_logs: [{scope, log_records}]}]}
+func (e *OTLPExporter) protoRequest(records []otlpRecord) []byte {
+	var resource []byte
+	for _, kv := range e.resource {
+		resource = protowire.AppendTag(resource, 1, protowire.BytesType)
+		resource = protowire.AppendBytes(resource, otlpProtoKeyValue(kv))
+	}
+	var scope []byte
+	scope = protowire.AppendTag(scope, 1, protowire.BytesType)
+	scope = protowire.AppendString(scope, "zlog")
+	var scopeLogs []byte
+	scopeLogs = protowire.AppendTag(scopeLogs, 1, protowire.BytesType)
+	scopeLogs = protowire.AppendBytes(scopeLogs, scope)
+	for _, r := range records {
+		scopeLogs = protowire.AppendTag(scopeLogs, 2, protowire.BytesType)
+		scopeLogs = protowire.AppendBytes(scopeLogs, otlpProtoRecord(r))
+	}
+	var resourceLogs []byte
+	resourceLogs = protowire.AppendTag(resourceLogs, 1, protowire.BytesType)
+	resourceLogs = protowire.AppendBytes(resourceLogs, resource)
+	resourceLogs = protowire.AppendTag(resourceLogs, 2, protowire.BytesType)
+	resourceLogs = protowire.AppendBytes(resourceLogs, scopeLogs)
+	var req []byte
+	req = protowire.AppendTag(req, 1, protowire.BytesType)
+	return protowire.AppendBytes(req, resourceLogs)
+}
+
+func otlpProtoRecord(r otlpRecord) []byte {
+	var b []byte
+	b = protowire.AppendTag(b, 1, protowire.Fixed64Type)
+	b = protowire.AppendFixed64(b, uint64(r.time.UnixNano()))
+	b = protowire.AppendTag(b, 2, protowire.VarintType)
+	b = protowire.AppendVarint(b, uint64(r.severity))
+	b = protowire.AppendTag(b, 3, protowire.BytesType)
+	b = protowire.AppendString(b, r.text)
+	b = protowire.AppendTag(b, 5, protowire.BytesType)
+	b = protowire.AppendBytes(b, otlpProtoValue(r.body))
+	for _, kv := range r.attrs {
+		b = protowire.AppendTag(b, 6, protowire.BytesType)
+		b = protowire.AppendBytes(b, otlpProtoKeyValue(kv))
+	}
+	if len(r.traceID) > 0 {
+		b = protowire.AppendTag(b, 9, protowire.BytesType)
+		b = protowire.AppendBytes(b, r.traceID)
+	}
+	if len(r.spanID) > 0 {
+		b = protowire.AppendTag(b, 10, protowire.BytesType)
+		b = protowire.AppendBytes(b, r.spanID)
+	}
+	b = protowire.AppendTag(b, 11, protowire.Fixed64Type)
+	return protowire.AppendFixed64(b, uint64(r.observed.UnixNano()))
+}
+
+func otlpProtoKeyValue(kv otlpKeyValue) []byte {
+	var b []byte
+	b = protowire.AppendTag(b, 1, protowire.BytesType)
+	b = protowire.AppendString(b, kv.key)
+	b = protowire.AppendTag(b, 2, protowire.BytesType)
+	return protowire.AppendBytes(b, otlpProtoValue(kv.value))
+}
+
+// otlpProtoValue AnyValue{string_value=1 bool_value=2 int_value=3 double_value=4 array_value=5 kvlist_value=6}
+func otlpProtoValue(v interface{}) []byte {
+	var b []byte
+	switch x := v.(type) {
+	case string:
+		b = protowire.AppendTag(b, 1, protowire.BytesType)
+		b = protowire.AppendString(b, x)
+	case bool:
+		b = protowire.AppendTag(b, 2, protowire.VarintType)
+		b = protowire.AppendVarint(b, protowire.EncodeBool(x))
+	case int64:
+		b = protowire.AppendTag(b, 3, protowire.VarintType)
+		b = protowire.AppendVarint(b, uint64(x))
+	case float64:
+		b = protowire.AppendTag(b, 4, protowire.Fixed64Type)
+		b = protowire.AppendFixed64(b, math.Float64bits(x))
+	case []interface{}:
+		var arr []byte
+		for _, item := range x {
+			arr = protowire.AppendTag(arr, 1, protowire.BytesType)
+			arr = protowire.AppendBytes(arr, otlpProtoValue(item))
+		}
+		b = protowire.AppendTag(b, 5, protowire.BytesType)
+		b = protowire.AppendBytes(b, arr)
+	case []otlpKeyValue:
+		var list []byte
+		for _, kv := range x {
+			list = protowire.AppendTag(list, 1, protowire.BytesType)
+			list = protowire.AppendBytes(list, otlpProtoKeyValue(kv))
+		}
+		b = protowire.AppendTag(b, 6, protowire.BytesType)
+		b = protowire.AppendBytes(b, list)
+	}
+	return b
+}
+
+// jsonRequest OTLP/JSON，64 位整数与时间戳编码为字符串，trace span id 编码为十六进制
+func (e *OTLPExporter) jsonRequest(records []otlpRecord) interface{} {
+	logs := make([]interface{}, len(records))
+	for i, r := range records {
+		m := map[string]interface{}{
+			"timeUnixNano":         strconv.FormatInt(r.time.UnixNano(), 10),
+			"observedTimeUnixNano": strconv.FormatInt(r.observed.UnixNano(), 10),
+			"severityNumber":       r.severity,
+			"severityText":         r.text,
+			"body":                 otlpJSONValue(r.body),
+			"attributes":           otlpJSONKeyValues(r.attrs),
+		}
+		if len(r.traceID) > 0 {
+			m["traceId"] = hex.EncodeToString(r.traceID)
+		}
+		if len(r.spanID) > 0 {
+			m["spanId"] = hex.EncodeToString(r.spanID)
+		}
+		logs[i] = m
+	}
+	return map[string]interface{}{
+		"resourceLogs": []interface{}{map[string]interface{}{
+			"resource": map[string]interface{}{"attributes": otlpJSONKeyValues(e.resource)},
+			"scopeLogs": []interface{}{map[string]interface{}{
+				"scope":      map[string]interface{}{"name": "zlog"},
+				"logRecords": logs,
+			}},
+		}},
+	}
+}
+
+func otlpJSONKeyValues(kvs []otlpKeyValue) []interface{} {
+	list := make([]interface{}, len(kvs))
+	for i, kv := range kvs {
+		list[i] = map[string]interface{}{"key": kv.key, "value": otlpJSONValue(kv.value)}
+	}
+	return list
+}
+
+func otlpJSONValue(v interface{}) interface{} {
+	switch x := v.(type) {
+	case string:
+		return map[string]interface{}{"stringValue": x}
+	case bool:
+		return map[string]interface{}{"boolValue": x}
+	case int64:
+		return map[string]interface{}{"intValue": strconv.FormatInt(x, 10)}
+	case float64:
+		return map[string]interface{}{"doubleValue": x}
+	case []interface{}:
+		values := make([]interface{}, len(x))
+		for i, item := range x {
+			values[i] = otlpJSONValue(item)
+		}
+		return map[string]interface{}{"arrayValue": map[string]interface{}{"values": values}}
+	case []otlpKeyValue:
+		return map[string]interface{}{"kvlistValue": map[string]interface{}{"values": otlpJSONKeyValues(x)}}
+	}
+	return map[string]interface{}{}
+}
+
+// otlpAttributes 按键排序转为属性，值转为 AnyValue 支持的类型
+func otlpAttributes(m map[string]interface{}) []otlpKeyValue {
+	kvs := make([]otlpKeyValue, 0, len(m))
+	for _, k := range sortedKeys(m) {
+		kvs = append(kvs, otlpKeyValue{key: k, value: otlpValue(m[k])})
+	}
+	return kvs
+}
+
+func otlpValue(v interface{}) interface{} {
+	switch x := v.(type) {
+	case string:
+		return x
+	case bool:
+		return x
+	case int:
+		return int64(x)
+	case int8:
+		return int64(x)
+	case int16:
+		return int64(x)
+	case int32:
+		return int64(x)
+	case int64:
+		return x
+	case uint:
+		return int64(x)
+	case uint8:
+		return int64(x)
+	case uint16:
+		return int64(x)
+	case uint32:
+		return int64(x)
+	case uint64:
+		return int64(x)
+	case float32:
+		return float64(x)
+	case float64:
+		return x
+	case []interface{}:
+		values := make([]interface{}, len(x))
+		for i, item := range x {
+			values[i] = otlpValue(item)
+		}
+		return values
+	case map[string]interface{}:
+		return otlpAttributes(x)
+	default:
+		return fieldString(v)
+	}
+}
+
+// otlpCore 每条日志转为 LogRecord，msg 为 body，字段为属性，trace_id span_id 字段作为关联的 trace
+type otlpCore struct {
+	zapcore.LevelEnabler
+	e      *OTLPExporter
+	fields []zapcore.Field
+}
+
+// NewOTLPCore 创建 OTLP/HTTP logs 输出 core，返回的 io.Closer 为 *OTLPExporter，可通过 Dropped 获取丢弃条数
+func NewOTLPCore(opts OTLPOptions) (zapcore.Core, io.Closer, error) {
+	e, err := NewOTLPExporter(opts)
+	if err != nil {
+		return nil, nil, err
+	}
+	return &otlpCore{LevelEnabler: zapcore.DebugLevel, e: e}, e, nil
+}
+
+// With implements zapcore.Core.
+func (c *otlpCore) With(fields []zapcore.Field) zapcore.Core {
+	n := *c
+	n.fields = make([]zapcore.Field, 0, len(c.fields)+len(fields))
+	n.fields = append(n.fields, c.fields...)
+	n.fields = append(n.fields, fields...)
+	return &n
+}
+
+// Check implements zapcore.Core.
+func (c *otlpCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(ent.Level) {
+		return ce.AddCore(ent, c)
+	}
+	return ce
+}
+
+// Write implements zapcore.Core.
+func (c *otlpCore) Write(ent zapcore.Entry, fields []zapcore.Field) error {
+	enc := zapcore.NewMapObjectEncoder()
+	for _, f := range c.fields {
+		f.AddTo(enc)
+	}
+	for _, f := range fields {
+		f.AddTo(enc)
+	}
+	r := otlpRecord{
+		time:     ent.Time,
+		observed: time.Now(),
+		severity: otlpSeverities[ent.Level],
+		text:     ent.Level.CapitalString(),
+		body:     ent.Message,
+	}
+	// trace_id traceId 等字段为合法的十六进制 id 时作为 LogRecord 的 trace_id span_id
+	for k, v := range enc.Fields {
+		s, ok := v.(string)
+		if !ok {
+			continue
+		}
+		switch configKey(k) {
+		case "traceid":
+			if id, err := hex.DecodeString(s); err == nil && len(id) == 16 {
+				r.traceID = id
+				delete(enc.Fields, k)
+			}
+		case "spanid":
+			if id, err := hex.DecodeString(s); err == nil && len(id) == 8 {
+				r.spanID = id
+				delete(enc.Fields, k)
+			}
+		}
+	}
+	if ent.LoggerName != "" {
+		enc.Fields["logger.name"] = ent.LoggerName
+	}
+	if ent.Caller.Defined {
+		enc.Fields["code.filepath"] = ent.Caller.File
+		enc.Fields["code.lineno"] = ent.Caller.Line
+		if ent.Caller.Function != "" {
+			enc.Fields["code.function"] = ent.Caller.Function
+		}
+	}
+	if ent.Stack != "" {
+		enc.Fields["code.stacktrace"] = ent.Stack
+	}
+	r.attrs = otlpAttributes(enc.Fields)
+	c.e.b.post(r, len(r.body)+len(r.attrs)*32)
+	return nil
+}
+
+// Sync implements zapcore.Core.
+func (c *otlpCore) Sync() error {
+	return c.e.Sync()
+}
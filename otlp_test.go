@@ -0,0 +1,162 @@
+package zlog
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+	"time"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// protoFields 遍历 protobuf 消息中 bytes 类型的字段
+func protoFields(t *testing.T, b []byte, fn func(num protowire.Number, v []byte)) {
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		b = b[n:]
+		if typ == protowire.BytesType {
+			v, n := protowire.ConsumeBytes(b)
+			fn(num, v)
+			b = b[n:]
+			continue
+		}
+		n = protowire.ConsumeFieldValue(num, typ, b)
+		if n < 0 {
+			t.Fatalf("invalid protobuf")
+		}
+		b = b[n:]
+	}
+}
+
+// otlpReceiver 记录收到的请求体
+func otlpReceiver(t *testing.T, contentType string) (*httptest.Server, chan []byte) {
+	bodies := make(chan []byte, 10)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != otlpLogsPath || r.Header.Get("Content-Type") != contentType {
+			t.Errorf("unexpected request %s %v", r.URL.Path, r.Header)
+		}
+		body, _ := io.ReadAll(r.Body)
+		bodies <- body
+	}))
+	return srv, bodies
+}
+
+func TestOTLPJSON(t *testing.T) {
+	srv, bodies := otlpReceiver(t, "application/json")
+	defer srv.Close()
+	logger, err := New(WithService("app"), WithOTLP(OTLPOptions{Endpoint: srv.URL, Encoding: OTLPJSON,
+		ResourceAttributes: map[string]interface{}{"deployment.environment": "test"}}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer logger.Close(context.Background())
+	logger.WithFields(map[string]interface{}{
+		"trace_id": "0102030405060708090a0b0c0d0e0f10", "span_id": "0102030405060708", "uid": 7, "ok": true,
+	}).Warn("hello otlp")
+	_ = logger.Sync()
+
+	var req struct {
+		ResourceLogs []struct {
+			Resource struct {
+				Attributes []struct {
+					Key   string                 `json:"key"`
+					Value map[string]interface{} `json:"value"`
+				} `json:"attributes"`
+			} `json:"resource"`
+			ScopeLogs []struct {
+				LogRecords []struct {
+					TimeUnixNano   string                 `json:"timeUnixNano"`
+					SeverityNumber int                    `json:"severityNumber"`
+					SeverityText   string                 `json:"severityText"`
+					Body           map[string]interface{} `json:"body"`
+					TraceID        string                 `json:"traceId"`
+					SpanID         string                 `json:"spanId"`
+					Attributes     []struct {
+						Key   string                 `json:"key"`
+						Value map[string]interface{} `json:"value"`
+					} `json:"attributes"`
+				} `json:"logRecords"`
+			} `json:"scopeLogs"`
+		} `json:"resourceLogs"`
+	}
+	select {
+	case body := <-bodies:
+		if err := json.Unmarshal(body, &req); err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("no export request")
+	}
+	resource := map[string]interface{}{}
+	for _, kv := range req.ResourceLogs[0].Resource.Attributes {
+		resource[kv.Key] = kv.Value["stringValue"]
+	}
+	if resource["service.name"] != "app" || resource["deployment.environment"] != "test" {
+		t.Fatalf("unexpected resource %v", resource)
+	}
+	r := req.ResourceLogs[0].ScopeLogs[0].LogRecords[0]
+	if r.SeverityNumber != 13 || r.SeverityText != "WARN" || r.Body["stringValue"] != "hello otlp" ||
+		r.TraceID != "0102030405060708090a0b0c0d0e0f10" || r.SpanID != "0102030405060708" || r.TimeUnixNano == "" {
+		t.Fatalf("unexpected record %+v", r)
+	}
+	attrs := map[string]map[string]interface{}{}
+	for _, kv := range r.Attributes {
+		attrs[kv.Key] = kv.Value
+	}
+	if attrs["uid"]["intValue"] != "7" || attrs["ok"]["boolValue"] != true || attrs["code.filepath"] == nil || attrs["trace_id"] != nil {
+		t.Fatalf("unexpected attributes %v", attrs)
+	}
+}
+
+func TestOTLPProtobuf(t *testing.T) {
+	srv, bodies := otlpReceiver(t, "application/x-protobuf")
+	defer srv.Close()
+	logger, err := New(WithOTLP(OTLPOptions{Endpoint: srv.URL, ServiceName: "app"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer logger.Close(context.Background())
+	logger.Error("hello otlp")
+	_ = logger.Sync()
+
+	var body []byte
+	select {
+	case body = <-bodies:
+	case <-time.After(2 * time.Second):
+		t.Fatal("no export request")
+	}
+	// resource_logs -> scope_logs -> log_records -> body.string_value
+	var resource []string
+	var msg string
+	protoFields(t, body, func(_ protowire.Number, rl []byte) {
+		protoFields(t, rl, func(num protowire.Number, v []byte) {
+			if num == 1 {
+				protoFields(t, v, func(_ protowire.Number, kv []byte) {
+					protoFields(t, kv, func(num protowire.Number, v []byte) {
+						if num == 2 {
+							resource = append(resource, string(v[2:]))
+						}
+					})
+				})
+				return
+			}
+			protoFields(t, v, func(num protowire.Number, rec []byte) {
+				if num != 2 {
+					return
+				}
+				protoFields(t, rec, func(num protowire.Number, v []byte) {
+					if num == 5 {
+						msg = string(v[2:])
+					}
+				})
+			})
+		})
+	})
+	if msg != "hello otlp" || !slices.Contains(resource, "app") {
+		t.Fatalf("unexpected export resource=%q msg=%q", resource, msg)
+	}
+}
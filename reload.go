@@ -0,0 +1,209 @@
+// @Author: openownworld
+// @Email:  openownworld@163.com
+// @File:   reload.go
+// @Description: 配置文件热加载，原子替换 zap core
+
+package zlog
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// coreState 某一版本配置创建的 core 和输出
+type coreState struct {
+	gen    uint64
+	config Config
+	core   zapcore.Core
+	out    *outputs
+}
+
+// coreHolder 持有当前版本的 core 和根 logger 的级别，Reload 时整体替换
+// 被 SetDefaultLogger 替换的默认 logger 转发到新的 holder，之前派生的子 logger 跟随新的默认 logger
+type coreHolder struct {
+	mu         sync.Mutex
+	state      atomic.Pointer[coreState]
+	next       atomic.Pointer[coreHolder]
+	level      zap.AtomicLevel // 根 logger 的动态 level，With Named 派生的子 logger 共享
+	stackLevel zap.AtomicLevel // 输出调用堆栈 级别
+	levels     *levelRegistry  // 命名 logger 前缀级别覆盖，只作用于该根 logger
+}
+
+func newCoreHolder(config Config, core zapcore.Core, out *outputs) *coreHolder {
+	h := &coreHolder{
+		level:      zap.NewAtomicLevelAt(getLevel(config.Level)),
+		stackLevel: zap.NewAtomicLevelAt(getLevel(config.StacktraceLevel)),
+		levels:     newLevelRegistry(),
+	}
+	h.state.Store(&coreState{gen: 1, config: config, core: core, out: out})
+	return h
+}
+
+// resolve 返回转发链末端当前生效的 holder
+func (h *coreHolder) resolve() *coreHolder {
+	for next := h.next.Load(); next != nil; next = h.next.Load() {
+		h = next
+	}
+	return h
+}
+
+func (h *coreHolder) load() *coreState {
+	return h.resolve().state.Load()
+}
+
+// swap 替换为新 core，返回旧版本
+func (h *coreHolder) swap(config Config, core zapcore.Core, out *outputs) *coreState {
+	h = h.resolve()
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	old := h.state.Load()
+	h.state.Store(&coreState{gen: old.gen + 1, config: config, core: core, out: out})
+	h.stackLevel.SetLevel(getLevel(config.StacktraceLevel))
+	return old
+}
+
+// forward 之后转发到 to，命名 logger 及 to 未设置的前缀级别覆盖并入 to，返回需要关闭的旧版本
+func (h *coreHolder) forward(to *coreHolder) *coreState {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	old := h.state.Load()
+	to.levels.merge(h.levels)
+	h.state.Store(&coreState{gen: old.gen + 1, config: old.config, core: zapcore.NewNopCore(), out: &outputs{}})
+	h.next.Store(to)
+	return old
+}
+
+// stackLevel 输出调用堆栈的级别，跟随转发后的 holder
+type stackLevel struct {
+	h *coreHolder
+}
+
+// Enabled implements zapcore.LevelEnabler.
+func (s stackLevel) Enabled(lvl zapcore.Level) bool {
+	return s.h.resolve().stackLevel.Enabled(lvl)
+}
+
+// reloadCore 记录 With 的字段，core 被替换后按新 core 重新 With 一次并缓存
+type reloadCore struct {
+	h      *coreHolder
+	fields []zapcore.Field
+	cache  atomic.Pointer[reloadCache]
+}
+
+// reloadCache 由 st 的 core With 字段得到的 core
+type reloadCache struct {
+	st   *coreState
+	core zapcore.Core
+}
+
+func (c *reloadCore) current() zapcore.Core {
+	st := c.h.load()
+	if cached := c.cache.Load(); cached != nil && cached.st == st {
+		return cached.core
+	}
+	core := st.core
+	if len(c.fields) > 0 {
+		core = core.With(c.fields)
+	}
+	c.cache.Store(&reloadCache{st: st, core: core})
+	return core
+}
+
+// Enabled implements zapcore.Core.
+func (c *reloadCore) Enabled(lvl zapcore.Level) bool {
+	return c.current().Enabled(lvl)
+}
+
+// With implements zapcore.Core.
+func (c *reloadCore) With(fields []zapcore.Field) zapcore.Core {
+	f := make([]zapcore.Field, 0, len(c.fields)+len(fields))
+	f = append(f, c.fields...)
+	f = append(f, fields...)
+	return &reloadCore{h: c.h, fields: f}
+}
+
+// Check implements zapcore.Core.
+func (c *reloadCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	return c.current().Check(ent, ce)
+}
+
+// Write implements zapcore.Core.
+func (c *reloadCore) Write(ent zapcore.Entry, fields []zapcore.Field) error {
+	return c.current().Write(ent, fields)
+}
+
+// Sync implements zapcore.Core.
+func (c *reloadCore) Sync() error {
+	return c.current().Sync()
+}
+
+// configFile InitLogByFile 使用的配置文件，WatchConfigFile 监听该文件
+var configFile atomic.Value
+
+type watchedFile struct {
+	path    string
+	section string
+}
+
+// WatchConfigFile 定时检查 InitLogByFile 使用的配置文件，内容变化后热加载到默认 logger
+// 解析失败的配置被丢弃，继续使用之前的配置，返回的函数用于停止
+func WatchConfigFile(interval time.Duration) (stop func(), err error) {
+	watched, _ := configFile.Load().(watchedFile)
+	filename := watched.path
+	if filename == "" {
+		return nil, fmt.Errorf("config file not set, init log by InitLogByFile first")
+	}
+	if interval <= 0 {
+		interval = 5 * time.Second
+	}
+	last, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("read config file [%s] failed: %v", filename, err)
+	}
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				data, err := os.ReadFile(filename)
+				if err != nil || bytes.Equal(data, last) {
+					continue
+				}
+				last = data
+				if err := reloadConfig(data, FormatByExt(filename), watched.section); err != nil {
+					GetDefaultLogger().Errorf("reload config file [%s] failed, keep previous config: %v", filename, err)
+					continue
+				}
+				GetDefaultLogger().Infof("reload config file [%s] success", filename)
+			case <-done:
+				return
+			}
+		}
+	}()
+	var once sync.Once
+	return func() { once.Do(func() { close(done) }) }, nil
+}
+
+func reloadConfig(data []byte, format ConfigFormat, section string) error {
+	logConfig, err := LoadConfig(data, format, section)
+	if err != nil {
+		return err
+	}
+	if err := ApplyEnv(&logConfig); err != nil {
+		return err
+	}
+	z, ok := unwrapZLogger(GetDefaultLogger())
+	if !ok {
+		return fmt.Errorf("default logger does not support reload")
+	}
+	return z.Reload(logConfig)
+}
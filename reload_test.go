@@ -0,0 +1,54 @@
+package zlog
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWatchConfigFile(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "log.ini")
+	logA := filepath.Join(dir, "a.log")
+	logB := filepath.Join(dir, "b.log")
+	write := func(content string) {
+		if err := os.WriteFile(file, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("level = info\nconsoleLogger = false\nlogFileName = " + logA + "\n")
+	if err := InitLogByFile(file); err != nil {
+		t.Fatal(err)
+	}
+	defer InitLog(GetDefaultConfig())
+	child := WithField("log", "child")
+	stop, err := WatchConfigFile(10 * time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stop()
+
+	write("level = warn\nconsoleLogger = false\nfileLoggerJSON = true\nlogFileName = " + logB + "\n")
+	for i := 0; i < 100 && GetLevel() != LevelWarn; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if GetLevel() != LevelWarn {
+		t.Fatalf("level %v after reload", GetLevel())
+	}
+	child.Info("drop")
+	child.Warn("keep")
+	data, _ := os.ReadFile(logB)
+	if !strings.Contains(string(data), `"msg":"keep","log":"child"`) || strings.Contains(string(data), "drop") {
+		t.Fatalf("unexpected log b: %s", data)
+	}
+
+	write("[unclosed\n")
+	time.Sleep(50 * time.Millisecond)
+	child.Error("still b")
+	data, _ = os.ReadFile(logB)
+	if !strings.Contains(string(data), "still b") {
+		t.Fatalf("bad config not rejected: %s", data)
+	}
+}
@@ -0,0 +1,315 @@
+// @Author: openownworld
+// @Email:  openownworld@163.com
+// @File:   rotate.go
+// @Description: 按时间切割日志文件，每小时或每天一个文件，周期内按大小再切割，按天数和个数清理
+
+package zlog
+
+import (
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"gopkg.in/natefinch/lumberjack.v2"
+)
+
+// Enums rotate period constants.
+const (
+	RotateSize   = "size"   // 只按 MaxSize 切割，lumberjack
+	RotateHourly = "hourly" // 整点切割 log.2006-01-02T15.log
+	RotateDaily  = "daily"  // 本地时间零点切割 log.2006-01-02.log
+)
+
+var rotateLayouts = map[string]string{
+	RotateHourly: "2006-01-02T15",
+	RotateDaily:  "2006-01-02",
+}
+
+var rotatePeriods = map[string]time.Duration{
+	RotateHourly: time.Hour,
+	RotateDaily:  24 * time.Hour,
+}
+
+// newRotateFile 按 Rotation 创建日志文件输出，Period 为空或 size 时使用 lumberjack
+// 返回的 io.WriteCloser Close 后下次写入重新打开文件
+func newRotateFile(filename string, r Rotation) (io.WriteCloser, error) {
+	period := strings.ToLower(r.Period)
+	if period == "" || period == RotateSize {
+		return &lumberjack.Logger{
+			Filename:   filename,     // 日志文件路径 ./log/log.log
+			MaxSize:    r.MaxSize,    // 最大文件大小 M字节
+			MaxBackups: r.MaxBackups, // 最多保留备份个数
+			MaxAge:     r.MaxDays,    // 文件最多保存多少天
+			Compress:   r.Compress,   // 是否压缩 disabled by default
+		}, nil
+	}
+	if _, ok := rotateLayouts[period]; !ok {
+		return nil, fmt.Errorf("unknown rotate period %q, want size, hourly or daily", r.Period)
+	}
+	ext := filepath.Ext(filename)
+	return &TimeRotateWriter{
+		prefix:     strings.TrimSuffix(filename, ext),
+		ext:        ext,
+		period:     period,
+		maxSize:    int64(r.MaxSize) * 1024 * 1024,
+		maxBackups: r.MaxBackups,
+		maxDays:    r.MaxDays,
+		compress:   r.Compress,
+		now:        time.Now,
+	}, nil
+}
+
+// TimeRotateWriter 按时间周期写入 prefix.<时间>.ext，周期内超过 maxSize 时写入 prefix.<时间>.<序号>.ext
+// 打开和切割后在后台按 maxDays maxBackups 清理旧文件，compress 时压缩为 .gz
+type TimeRotateWriter struct {
+	prefix     string // ./logs/log
+	ext        string // .log
+	period     string
+	maxSize    int64
+	maxBackups int
+	maxDays    int
+	compress   bool
+	now        func() time.Time
+	mu         sync.Mutex
+	file       *os.File
+	key        string // 当前文件的时间部分
+	index      int
+	size       int64
+	millMu     sync.Mutex
+}
+
+// Filename 当前写入的文件名，未打开时为空
+func (w *TimeRotateWriter) Filename() string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.file == nil {
+		return ""
+	}
+	return w.name(w.key, w.index)
+}
+
+// Write implements io.Writer. 进入新的周期或超过 maxSize 时切换文件
+func (w *TimeRotateWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	key := w.now().Format(rotateLayouts[w.period])
+	if w.file == nil || key != w.key {
+		if err := w.open(key); err != nil {
+			return 0, err
+		}
+		// 与 lumberjack 一样第一次打开时也清理，重启后不必等到下一个周期
+		w.startMill()
+	}
+	if w.maxSize > 0 && w.size > 0 && w.size+int64(len(p)) > w.maxSize {
+		if err := w.openIndex(w.index + 1); err != nil {
+			return 0, err
+		}
+		w.startMill()
+	}
+	n, err := w.file.Write(p)
+	w.size += int64(n)
+	return n, err
+}
+
+// Close implements io.Closer. 下次写入时重新打开，配合 Reopen 使用
+func (w *TimeRotateWriter) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.closeFile()
+}
+
+func (w *TimeRotateWriter) closeFile() error {
+	if w.file == nil {
+		return nil
+	}
+	err := w.file.Close()
+	w.file = nil
+	return err
+}
+
+// name 第一个文件没有序号，之后为 .1 .2
+func (w *TimeRotateWriter) name(key string, index int) string {
+	if index == 0 {
+		return w.prefix + "." + key + w.ext
+	}
+	return w.prefix + "." + key + "." + strconv.Itoa(index) + w.ext
+}
+
+// open 打开周期 key 中序号最大的文件，已满时打开下一个
+func (w *TimeRotateWriter) open(key string) error {
+	if err := os.MkdirAll(filepath.Dir(w.prefix), 0755); err != nil {
+		return fmt.Errorf("can't make directories for new logfile: %v", err)
+	}
+	index := 0
+	files, _ := w.list()
+	for _, f := range files {
+		if f.key == key {
+			// 已压缩的文件不再追加
+			if index = f.index; f.gz {
+				index++
+			}
+			break
+		}
+	}
+	w.key = key
+	if err := w.openIndex(index); err != nil {
+		return err
+	}
+	if w.maxSize > 0 && w.size >= w.maxSize {
+		return w.openIndex(index + 1)
+	}
+	return nil
+}
+
+// openIndex 关闭当前文件，追加打开当前周期的第 index 个文件
+func (w *TimeRotateWriter) openIndex(index int) error {
+	if err := w.closeFile(); err != nil {
+		return err
+	}
+	name := w.name(w.key, index)
+	f, err := os.OpenFile(name, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return fmt.Errorf("can't open new logfile: %v", err)
+	}
+	info, err := f.Stat()
+	if err != nil {
+		_ = f.Close()
+		return err
+	}
+	w.file, w.index, w.size = f, index, info.Size()
+	return nil
+}
+
+// rotatedFile 按时间切割的一个文件
+type rotatedFile struct {
+	path  string
+	key   string
+	t     time.Time
+	index int
+	gz    bool
+}
+
+// list 目录中属于该输出的文件，按时间和序号从新到旧排序
+func (w *TimeRotateWriter) list() ([]rotatedFile, error) {
+	dir, base := filepath.Split(w.prefix)
+	entries, err := os.ReadDir(filepath.Clean(dir + "."))
+	if err != nil {
+		return nil, err
+	}
+	layout := rotateLayouts[w.period]
+	var files []rotatedFile
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || !strings.HasPrefix(name, base+".") {
+			continue
+		}
+		f := rotatedFile{path: filepath.Join(dir, name)}
+		rest := strings.TrimPrefix(name, base+".")
+		if f.gz = strings.HasSuffix(rest, ".gz"); f.gz {
+			rest = strings.TrimSuffix(rest, ".gz")
+		}
+		if !strings.HasSuffix(rest, w.ext) {
+			continue
+		}
+		rest = strings.TrimSuffix(rest, w.ext)
+		if key, index, ok := strings.Cut(rest, "."); ok {
+			n, err := strconv.Atoi(index)
+			if err != nil || n <= 0 {
+				continue
+			}
+			rest, f.index = key, n
+		}
+		t, err := time.ParseInLocation(layout, rest, time.Local)
+		if err != nil {
+			continue
+		}
+		f.key, f.t = rest, t
+		files = append(files, f)
+	}
+	sort.Slice(files, func(i, j int) bool {
+		if !files[i].t.Equal(files[j].t) {
+			return files[i].t.After(files[j].t)
+		}
+		return files[i].index > files[j].index
+	})
+	return files, nil
+}
+
+// startMill 后台清理旧文件
+func (w *TimeRotateWriter) startMill() {
+	if w.maxDays <= 0 && w.maxBackups <= 0 && !w.compress {
+		return
+	}
+	go func() {
+		w.millMu.Lock()
+		defer w.millMu.Unlock()
+		if err := w.mill(); err != nil {
+			fmt.Fprintf(os.Stderr, "%s zlog: clean %s files: %v\n", getNowTimeMs(), w.prefix, err)
+		}
+	}()
+}
+
+// mill 删除超过 maxDays 的文件和 maxBackups 之外的旧文件，压缩其余已切割的文件
+// 只处理比当前文件旧的文件，清理期间新切割的文件留到下次
+func (w *TimeRotateWriter) mill() error {
+	w.mu.Lock()
+	key, index := w.key, w.index
+	w.mu.Unlock()
+	current, err := time.ParseInLocation(rotateLayouts[w.period], key, time.Local)
+	if err != nil {
+		return err
+	}
+	files, err := w.list()
+	if err != nil {
+		return err
+	}
+	cutoff := w.now().Add(-time.Duration(w.maxDays) * 24 * time.Hour)
+	var errs []error
+	backups := 0
+	for _, f := range files {
+		if f.t.After(current) || (f.t.Equal(current) && f.index >= index) {
+			continue
+		}
+		expired := w.maxDays > 0 && f.t.Add(rotatePeriods[w.period]).Before(cutoff)
+		if backups++; expired || (w.maxBackups > 0 && backups > w.maxBackups) {
+			if err := os.Remove(f.path); err != nil && !errors.Is(err, os.ErrNotExist) {
+				errs = append(errs, err)
+			}
+			continue
+		}
+		if w.compress && !f.gz {
+			if err := compressLogFile(f.path); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// compressLogFile 压缩为 .gz 后删除原文件
+func compressLogFile(src string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(src+".gz", os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	zw := gzip.NewWriter(out)
+	_, err = io.Copy(zw, in)
+	if err = errors.Join(err, zw.Close(), out.Close()); err != nil {
+		_ = os.Remove(src + ".gz")
+		return err
+	}
+	return os.Remove(src)
+}
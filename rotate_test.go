@@ -0,0 +1,175 @@
+package zlog
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeClock 可调整的时间，mill 在后台读取
+type fakeClock struct {
+	mu sync.Mutex
+	t  time.Time
+}
+
+func (c *fakeClock) now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.t
+}
+
+func (c *fakeClock) set(t time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.t = t
+}
+
+func newTestRotate(t *testing.T, path string, r Rotation, clock *fakeClock) *TimeRotateWriter {
+	wc, err := newRotateFile(path, r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := wc.(*TimeRotateWriter)
+	w.now = clock.now
+	t.Cleanup(func() { _ = w.Close() })
+	return w
+}
+
+func dirFiles(t *testing.T, dir string) []string {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	sort.Strings(names)
+	return names
+}
+
+func TestTimeRotateHourly(t *testing.T) {
+	dir := t.TempDir()
+	clock := &fakeClock{t: time.Date(2026, 10, 17, 13, 5, 0, 0, time.Local)}
+	w := newTestRotate(t, filepath.Join(dir, "log.log"), Rotation{Period: RotateHourly}, clock)
+	w.maxSize = 4
+	for _, s := range []string{"a\n", "bbb\n"} {
+		if _, err := w.Write([]byte(s)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if w.Filename() != filepath.Join(dir, "log.2026-10-17T13.1.log") {
+		t.Fatalf("unexpected filename %s", w.Filename())
+	}
+	clock.set(time.Date(2026, 10, 17, 14, 0, 0, 0, time.Local))
+	if _, err := w.Write([]byte("c\n")); err != nil {
+		t.Fatal(err)
+	}
+	// 重新打开后继续写入当前周期序号最大的文件
+	_ = w.Close()
+	if _, err := w.Write([]byte("d\n")); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{
+		"log.2026-10-17T13.log":   "a\n",
+		"log.2026-10-17T13.1.log": "bbb\n",
+		"log.2026-10-17T14.log":   "c\nd\n",
+	}
+	if names := dirFiles(t, dir); len(names) != len(want) {
+		t.Fatalf("unexpected files %v", names)
+	}
+	for name, content := range want {
+		if b, _ := os.ReadFile(filepath.Join(dir, name)); string(b) != content {
+			t.Fatalf("%s: got %q, want %q", name, b, content)
+		}
+	}
+}
+
+func TestTimeRotateRetention(t *testing.T) {
+	dir := t.TempDir()
+	for _, day := range []string{"12", "13", "14", "15", "16"} {
+		if err := os.WriteFile(filepath.Join(dir, "log.2026-10-"+day+".log"), []byte(day), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// 其他文件不受影响
+	if err := os.WriteFile(filepath.Join(dir, "log.other.log"), nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+	clock := &fakeClock{t: time.Date(2026, 10, 17, 10, 0, 0, 0, time.Local)}
+	w := newTestRotate(t, filepath.Join(dir, "log.log"), Rotation{Period: RotateDaily, MaxDays: 3, MaxBackups: 2, Compress: true}, clock)
+	if _, err := w.Write([]byte("17")); err != nil {
+		t.Fatal(err)
+	}
+	clock.set(time.Date(2026, 10, 18, 10, 0, 0, 0, time.Local))
+	if _, err := w.Write([]byte("18")); err != nil {
+		t.Fatal(err)
+	}
+	want := "log.2026-10-16.log.gz,log.2026-10-17.log.gz,log.2026-10-18.log,log.other.log"
+	var got string
+	for deadline := time.Now().Add(2 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		w.millMu.Lock()
+		got = strings.Join(dirFiles(t, dir), ",")
+		w.millMu.Unlock()
+		if got == want {
+			return
+		}
+	}
+	t.Fatalf("got %s, want %s", got, want)
+}
+
+func TestTimeRotateMillOnOpen(t *testing.T) {
+	dir := t.TempDir()
+	for _, day := range []string{"14", "15", "16"} {
+		if err := os.WriteFile(filepath.Join(dir, "log.2026-10-"+day+".log"), []byte(day), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// 重启后第一次写入即按 MaxBackups 清理
+	clock := &fakeClock{t: time.Date(2026, 10, 17, 10, 0, 0, 0, time.Local)}
+	w := newTestRotate(t, filepath.Join(dir, "log.log"), Rotation{Period: RotateDaily, MaxBackups: 1}, clock)
+	if _, err := w.Write([]byte("17")); err != nil {
+		t.Fatal(err)
+	}
+	want := "log.2026-10-16.log,log.2026-10-17.log"
+	var got string
+	for deadline := time.Now().Add(2 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		w.millMu.Lock()
+		got = strings.Join(dirFiles(t, dir), ",")
+		w.millMu.Unlock()
+		if got == want {
+			return
+		}
+	}
+	t.Fatalf("got %s, want %s", got, want)
+}
+
+func TestRotatePeriodConfig(t *testing.T) {
+	c := GetDefaultConfig()
+	c.RotatePeriod = "weekly"
+	if err := c.Validate(); err == nil || !strings.Contains(err.Error(), "rotatePeriod") {
+		t.Fatalf("expect rotatePeriod error, got %v", err)
+	}
+	dir := t.TempDir()
+	c.RotatePeriod = RotateDaily
+	c.LogFileName = filepath.Join(dir, "log.log")
+	c.ErrorFileName = filepath.Join(dir, "error.log")
+	c.ConsoleLogger = false
+	c.FileLogger, c.ErrorFileEnable = true, true
+	logger, err := newZLogger(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	logger.Error("boom")
+	day := time.Now().Format("2006-01-02")
+	for _, name := range []string{"log." + day + ".log", "error." + day + ".log"} {
+		if b, _ := os.ReadFile(filepath.Join(dir, name)); !strings.Contains(string(b), "boom") {
+			t.Fatalf("%s: unexpected content %q", name, b)
+		}
+	}
+	_ = logger.h.load().out.close()
+}
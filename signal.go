@@ -0,0 +1,83 @@
+// @Author: openownworld
+// @Email:  openownworld@163.com
+// @File:   signal.go
+// @Description: 信号切换 debug 级别、重新打开日志文件
+
+package zlog
+
+import (
+	"os"
+	"os/signal"
+	"sync"
+)
+
+// HandleSignals 启用信号处理，返回的函数用于停止
+// SIGUSR1 默认 logger 在 Config.Level 与 debug 之间切换
+// SIGHUP  重新打开 LogFileName ErrorFileName，配合外部 logrotate copytruncate 使用
+// windows 下不支持，直接返回
+func HandleSignals() (stop func()) {
+	if len(toggleSignals) == 0 && len(reopenSignals) == 0 {
+		return func() {}
+	}
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, append(append([]os.Signal{}, toggleSignals...), reopenSignals...)...)
+	done := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case sig := <-ch:
+				handleSignal(sig)
+			case <-done:
+				return
+			}
+		}
+	}()
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			signal.Stop(ch)
+			close(done)
+		})
+	}
+}
+
+func handleSignal(sig os.Signal) {
+	for _, s := range toggleSignals {
+		if s == sig {
+			level := ToggleDebug()
+			GetDefaultLogger().Warnf("receive signal %v, log level switch to %s", sig, level.String())
+			return
+		}
+	}
+	for _, s := range reopenSignals {
+		if s == sig {
+			if err := Reopen(); err != nil {
+				GetDefaultLogger().Errorf("receive signal %v, reopen log file failed: %v", sig, err)
+			}
+			return
+		}
+	}
+}
+
+// ToggleDebug 默认 logger 在 Config.Level 与 debug 之间切换，返回切换后的级别
+func ToggleDebug() Level {
+	logger := GetDefaultLogger()
+	base := LevelInfo
+	if z, ok := unwrapZLogger(logger); ok {
+		base = zapLevelToLevel[getLevel(z.h.load().config.Level)]
+	}
+	level := LevelDebug
+	if logger.GetLevel() == LevelDebug {
+		level = base
+	}
+	logger.SetLevel(level)
+	return level
+}
+
+// Reopen 默认 logger 重新打开日志文件
+func Reopen() error {
+	if z, ok := unwrapZLogger(GetDefaultLogger()); ok {
+		return z.Reopen()
+	}
+	return nil
+}
@@ -0,0 +1,52 @@
+//go:build !windows
+
+package zlog
+
+import (
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestHandleSignals(t *testing.T) {
+	dir := t.TempDir()
+	cfg := GetDefaultConfig()
+	cfg.Level = "warn"
+	cfg.ConsoleLogger = false
+	cfg.LogFileName = filepath.Join(dir, "log.log")
+	InitLog(cfg)
+	defer InitLog(GetDefaultConfig())
+	stop := HandleSignals()
+	// 重复调用不 panic
+	defer stop()
+	defer stop()
+
+	waitLevel := func(want Level) {
+		for i := 0; i < 100 && GetLevel() != want; i++ {
+			time.Sleep(10 * time.Millisecond)
+		}
+		if GetLevel() != want {
+			t.Fatalf("level %v, want %v", GetLevel(), want)
+		}
+	}
+	_ = syscall.Kill(os.Getpid(), syscall.SIGUSR1)
+	waitLevel(LevelDebug)
+	_ = syscall.Kill(os.Getpid(), syscall.SIGUSR1)
+	waitLevel(LevelWarn)
+
+	Warn("before rotate")
+	if err := os.Rename(cfg.LogFileName, cfg.LogFileName+".1"); err != nil {
+		t.Fatal(err)
+	}
+	_ = syscall.Kill(os.Getpid(), syscall.SIGHUP)
+	for i := 0; i < 100; i++ {
+		Warn("after rotate")
+		if _, err := os.Stat(cfg.LogFileName); err == nil {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatal("log file not reopened after SIGHUP")
+}
@@ -0,0 +1,18 @@
+//go:build !windows
+
+// @Author: openownworld
+// @Email:  openownworld@163.com
+// @File:   signal_unix.go
+// @Description: unix 平台切换日志级别与重新打开日志文件的信号
+
+package zlog
+
+import (
+	"os"
+	"syscall"
+)
+
+var (
+	toggleSignals = []os.Signal{syscall.SIGUSR1}
+	reopenSignals = []os.Signal{syscall.SIGHUP}
+)
@@ -0,0 +1,15 @@
+//go:build windows
+
+// @Author: openownworld
+// @Email:  openownworld@163.com
+// @File:   signal_windows.go
+// @Description: windows 不支持 SIGUSR1 SIGHUP 等信号
+
+package zlog
+
+import "os"
+
+var (
+	toggleSignals []os.Signal
+	reopenSignals []os.Signal
+)
@@ -0,0 +1,413 @@
+// @Author: openownworld
+// @Email:  openownworld@163.com
+// @File:   socket.go
+// @Description: socket 输出，udp 直接发送，tcp tls unix 等流式连接断线重连
+
+package zlog
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Enums socket framing constants.
+const (
+	FramingNewline = "newline" // 每条日志以换行结尾
+	FramingOctet   = "octet"   // RFC 6587 octet counting: "长度 日志"
+	FramingNull    = "null"    // 每条日志以 \0 结尾，GELF tcp 使用
+)
+
+const (
+	defaultSocketBufferSize = 1000
+	socketDialTimeout       = 3 * time.Second
+	socketWriteTimeout      = 5 * time.Second
+	minReconnectBackoff     = 100 * time.Millisecond
+	maxReconnectBackoff     = 30 * time.Second
+)
+
+// socketFramings 支持的 SocketFraming，为空按 newline 处理
+var socketFramings = map[string]bool{
+	"":             true,
+	FramingNewline: true,
+	FramingOctet:   true,
+	FramingNull:    true,
+}
+
+// StreamOptions 流式 socket 输出选项
+type StreamOptions struct {
+	Framing    string        // newline octet null，默认 newline
+	BufferSize int           // 断线期间最多缓存的日志条数，超出丢弃最旧的，默认 1000
+	MinBackoff time.Duration // 重连最小间隔，默认 100ms，失败后翻倍
+	MaxBackoff time.Duration // 重连最大间隔，默认 30s
+	TLS        *tls.Config   // tls 连接配置，为空时使用系统根证书，ServerName 取地址中的主机名
+}
+
+// TLSOptions tls socket 输出的证书配置，文件均为 PEM 格式
+type TLSOptions struct {
+	CAFile     string // 校验服务端证书的 CA，为空使用系统根证书
+	CertFile   string // 客户端证书，双向认证时与 KeyFile 一起配置
+	KeyFile    string // 客户端私钥
+	ServerName string // 校验服务端证书的主机名，为空取地址中的主机名
+	MinVersion string // 最低版本 1.0 1.1 1.2 1.3，默认 1.2
+}
+
+// tlsVersions 支持的 tls 最低版本，为空按 1.2 处理
+var tlsVersions = map[string]uint16{
+	"":    tls.VersionTLS12,
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// Config 按证书文件创建 tls.Config
+func (o TLSOptions) Config() (*tls.Config, error) {
+	version, ok := tlsVersions[o.MinVersion]
+	if !ok {
+		return nil, fmt.Errorf("unknown tls version %q", o.MinVersion)
+	}
+	c := &tls.Config{ServerName: o.ServerName, MinVersion: version}
+	if o.CAFile != "" {
+		pem, err := os.ReadFile(o.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("read tls ca file failed: %v", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificate found in tls ca file %s", o.CAFile)
+		}
+		c.RootCAs = pool
+	}
+	if o.CertFile != "" || o.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(o.CertFile, o.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("load tls client certificate failed: %v", err)
+		}
+		c.Certificates = []tls.Certificate{cert}
+	}
+	return c, nil
+}
+
+// StreamWriter 流式 socket 输出，断线后按指数退避重连，断线期间缓存有限条数的日志
+type StreamWriter struct {
+	name    string
+	dial    func() (net.Conn, error)
+	opts    StreamOptions
+	mu      sync.Mutex
+	conn    net.Conn
+	queue   [][]byte
+	closed  bool
+	wake    chan struct{}
+	done    chan struct{}
+	dropped atomic.Uint64
+	report  uint64 // 已报告的丢弃条数
+}
+
+// NewStreamWriter 创建流式 socket 输出，首次连接失败不返回错误，在后台重连
+func NewStreamWriter(network, addr string, opts StreamOptions) *StreamWriter {
+	return newStreamWriter(network+" "+addr, func() (net.Conn, error) {
+		return net.DialTimeout(network, addr, socketDialTimeout)
+	}, opts)
+}
+
+// NewTLSWriter 创建 tls socket 输出，断线重连行为与 NewStreamWriter 一致
+func NewTLSWriter(addr string, opts StreamOptions) *StreamWriter {
+	c := opts.TLS
+	if c == nil {
+		c = &tls.Config{MinVersion: tls.VersionTLS12}
+	}
+	if c.ServerName == "" {
+		c = c.Clone()
+		if host, _, err := net.SplitHostPort(addr); err == nil {
+			c.ServerName = host
+		}
+	}
+	return newStreamWriter("tls "+addr, func() (net.Conn, error) {
+		return tls.DialWithDialer(&net.Dialer{Timeout: socketDialTimeout}, "tcp", addr, c)
+	}, opts)
+}
+
+func newStreamWriter(name string, dial func() (net.Conn, error), opts StreamOptions) *StreamWriter {
+	// 与 Validate 一致，分帧方式不区分大小写
+	opts.Framing = strings.ToLower(opts.Framing)
+	if opts.BufferSize <= 0 {
+		opts.BufferSize = defaultSocketBufferSize
+	}
+	if opts.MinBackoff <= 0 {
+		opts.MinBackoff = minReconnectBackoff
+	}
+	if opts.MaxBackoff < opts.MinBackoff {
+		opts.MaxBackoff = maxReconnectBackoff
+	}
+	w := &StreamWriter{
+		name: name,
+		dial: dial,
+		opts: opts,
+		wake: make(chan struct{}, 1),
+		done: make(chan struct{}),
+	}
+	if conn, err := dial(); err == nil {
+		w.conn = conn
+	} else {
+		w.signal()
+	}
+	go w.run()
+	return w
+}
+
+// Write implements io.Writer. 写入失败或断线时缓存日志并在后台重连，不返回错误
+func (w *StreamWriter) Write(p []byte) (int, error) {
+	frame := w.frame(p)
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.closed {
+		return 0, errors.New("zlog: write to closed " + w.name)
+	}
+	if w.conn != nil && len(w.queue) == 0 {
+		if err := w.writeConn(frame); err == nil {
+			return len(p), nil
+		}
+	}
+	w.enqueue(frame)
+	return len(p), nil
+}
+
+// Sync implements zapcore.WriteSyncer.
+func (w *StreamWriter) Sync() error {
+	return nil
+}
+
+// Close implements io.Closer. 断线期间未发送的日志被丢弃
+func (w *StreamWriter) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.closed {
+		return nil
+	}
+	w.closed = true
+	close(w.done)
+	w.dropped.Add(uint64(len(w.queue)))
+	w.queue = nil
+	if w.conn != nil {
+		err := w.conn.Close()
+		w.conn = nil
+		return err
+	}
+	return nil
+}
+
+// Dropped 缓存已满或关闭时丢弃的日志条数
+func (w *StreamWriter) Dropped() uint64 {
+	return w.dropped.Load()
+}
+
+func (w *StreamWriter) frame(p []byte) []byte {
+	if w.opts.Framing == FramingOctet {
+		msg := strings.TrimRight(string(p), "\n")
+		return []byte(strconv.Itoa(len(msg)) + " " + msg)
+	}
+	if w.opts.Framing == FramingNull {
+		msg := bytes.TrimRight(p, "\n")
+		frame := make([]byte, len(msg)+1)
+		copy(frame, msg)
+		return frame
+	}
+	frame := make([]byte, len(p), len(p)+1)
+	copy(frame, p)
+	if len(frame) == 0 || frame[len(frame)-1] != '\n' {
+		frame = append(frame, '\n')
+	}
+	return frame
+}
+
+// writeConn 调用方持有锁，失败时断开连接并通知重连
+func (w *StreamWriter) writeConn(frame []byte) error {
+	_ = w.conn.SetWriteDeadline(time.Now().Add(socketWriteTimeout))
+	if _, err := w.conn.Write(frame); err != nil {
+		_ = w.conn.Close()
+		w.conn = nil
+		w.signal()
+		return err
+	}
+	return nil
+}
+
+// enqueue 调用方持有锁，缓存已满时丢弃最旧的
+func (w *StreamWriter) enqueue(frame []byte) {
+	if len(w.queue) >= w.opts.BufferSize {
+		w.queue[0] = nil
+		w.queue = w.queue[1:]
+		w.dropped.Add(1)
+	}
+	w.queue = append(w.queue, frame)
+	if w.conn == nil {
+		w.signal()
+	}
+}
+
+func (w *StreamWriter) signal() {
+	select {
+	case w.wake <- struct{}{}:
+	default:
+	}
+}
+
+// run 后台重连，连接成功后按顺序发送缓存的日志
+func (w *StreamWriter) run() {
+	backoff := w.opts.MinBackoff
+	for {
+		select {
+		case <-w.wake:
+		case <-w.done:
+			return
+		}
+		for !w.connectAndFlush() {
+			select {
+			case <-time.After(backoff):
+			case <-w.done:
+				return
+			}
+			backoff *= 2
+			if backoff > w.opts.MaxBackoff {
+				backoff = w.opts.MaxBackoff
+			}
+		}
+		backoff = w.opts.MinBackoff
+	}
+}
+
+func (w *StreamWriter) connectAndFlush() bool {
+	w.mu.Lock()
+	connected := w.conn != nil || w.closed
+	w.mu.Unlock()
+	var conn net.Conn
+	if !connected {
+		c, err := w.dial()
+		if err != nil {
+			return false
+		}
+		conn = c
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.closed {
+		if conn != nil {
+			_ = conn.Close()
+		}
+		return true
+	}
+	if conn != nil {
+		w.conn = conn
+	}
+	for len(w.queue) > 0 {
+		if err := w.writeConn(w.queue[0]); err != nil {
+			return false
+		}
+		w.queue[0] = nil
+		w.queue = w.queue[1:]
+	}
+	if d := w.dropped.Load(); d > w.report {
+		fmt.Fprintf(os.Stderr, "%s zlog: %s dropped %d log entries while disconnected\n", getNowTimeMs(), w.name, d-w.report)
+		w.report = d
+	}
+	return true
+}
+
+// DatagramWriter 数据报 socket 输出，每条日志一个数据报
+// 对端重启等写入失败时丢弃该条日志，下次写入时重新连接
+type DatagramWriter struct {
+	name    string
+	network string
+	addr    string
+	mu      sync.Mutex
+	conn    net.Conn
+	closed  bool
+	dropped atomic.Uint64
+	report  uint64 // 已报告的丢弃条数
+}
+
+// NewDatagramWriter 创建数据报 socket 输出，首次连接失败不返回错误，写入时重连
+func NewDatagramWriter(network, addr string) *DatagramWriter {
+	w := &DatagramWriter{name: network + " " + addr, network: network, addr: addr}
+	w.conn, _ = net.DialTimeout(network, addr, socketDialTimeout)
+	return w
+}
+
+// Write implements io.Writer.
+func (w *DatagramWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.closed {
+		return 0, errors.New("zlog: write to closed " + w.name)
+	}
+	if w.conn == nil {
+		conn, err := net.DialTimeout(w.network, w.addr, socketDialTimeout)
+		if err != nil {
+			w.dropped.Add(1)
+			return len(p), nil
+		}
+		w.conn = conn
+		if d := w.dropped.Load(); d > w.report {
+			fmt.Fprintf(os.Stderr, "%s zlog: %s dropped %d log entries while disconnected\n", getNowTimeMs(), w.name, d-w.report)
+			w.report = d
+		}
+	}
+	if _, err := w.conn.Write(p); err != nil {
+		_ = w.conn.Close()
+		w.conn = nil
+		w.dropped.Add(1)
+	}
+	return len(p), nil
+}
+
+// Sync implements zapcore.WriteSyncer.
+func (w *DatagramWriter) Sync() error {
+	return nil
+}
+
+// Close implements io.Closer.
+func (w *DatagramWriter) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.closed = true
+	if w.conn != nil {
+		err := w.conn.Close()
+		w.conn = nil
+		return err
+	}
+	return nil
+}
+
+// Dropped 连接失败或写入失败丢弃的日志条数
+func (w *DatagramWriter) Dropped() uint64 {
+	return w.dropped.Load()
+}
+
+// newSocketWriter 按 SocketType 创建 socket 输出，udp 直接发送，tcp tls unix 断线重连，unixgram 写入失败时重连
+func newSocketWriter(network, addr string, opts StreamOptions) (io.WriteCloser, error) {
+	switch strings.ToLower(network) {
+	case "", "udp":
+		return net.DialTimeout("udp", addr, socketDialTimeout)
+	case "tcp":
+		return NewStreamWriter("tcp", addr, opts), nil
+	case "tls":
+		return NewTLSWriter(addr, opts), nil
+	case "unix":
+		return NewStreamWriter("unix", addr, opts), nil
+	case "unixgram":
+		return NewDatagramWriter("unixgram", addr), nil
+	default:
+		return nil, fmt.Errorf("unsupported socket type %q", network)
+	}
+}
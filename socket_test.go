@@ -0,0 +1,208 @@
+package zlog
+
+import (
+	"bufio"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStreamWriterReconnect(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+	w := NewStreamWriter("tcp", addr, StreamOptions{BufferSize: 2, MinBackoff: 10 * time.Millisecond, MaxBackoff: 50 * time.Millisecond})
+	defer w.Close()
+	conn, err := ln.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _ = w.Write([]byte("first\n"))
+	line, _ := bufio.NewReader(conn).ReadString('\n')
+	if line != "first\n" {
+		t.Fatalf("unexpected line %q", line)
+	}
+	// 服务端重启，断线期间最多缓存 2 条
+	conn.Close()
+	ln.Close()
+	for i := 0; i < 50 && w.Dropped() == 0; i++ {
+		_, _ = w.Write([]byte("lost\n"))
+		time.Sleep(5 * time.Millisecond)
+	}
+	_, _ = w.Write([]byte("a\n"))
+	_, _ = w.Write([]byte("b"))
+	if w.Dropped() == 0 {
+		t.Fatal("expect dropped entries")
+	}
+	ln, err = net.Listen("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	conn, err = ln.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	var got []string
+	for i := 0; i < 2; i++ {
+		_ = conn.SetReadDeadline(time.Now().Add(time.Second))
+		line, err := r.ReadString('\n')
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, line)
+	}
+	if strings.Join(got, "") != "a\nb\n" {
+		t.Fatalf("unexpected buffered lines %q", got)
+	}
+}
+
+func TestSocketLoggerTCPOctet(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	logger, err := New(WithSocket("tcp", ln.Addr().String(), SinkFormat("json"), SinkStream(StreamOptions{Framing: "Octet"})))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer logger.Close(context.Background())
+	conn, err := ln.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	logger.Info("octet")
+	r := bufio.NewReader(conn)
+	_ = conn.SetReadDeadline(time.Now().Add(time.Second))
+	head, err := r.ReadString(' ')
+	if err != nil {
+		t.Fatal(err)
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(head))
+	if err != nil {
+		t.Fatalf("unexpected octet frame %q", head)
+	}
+	msg := make([]byte, n)
+	if _, err := io.ReadFull(r, msg); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(string(msg), "{") || !strings.HasSuffix(string(msg), `"msg":"octet"}`) {
+		t.Fatalf("unexpected octet message %q", msg)
+	}
+}
+
+// writeTestCert 生成 CA 签发的证书，返回 CA 证书池与 PEM 文件路径
+func writeTestCert(t *testing.T, dir, name string, ca *x509.Certificate, caKey *ecdsa.PrivateKey, isCA bool) (*x509.Certificate, *ecdsa.PrivateKey, string, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: name},
+		DNSNames:              []string{name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  isCA,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	parent, parentKey := tmpl, key
+	if ca != nil {
+		parent, parentKey = ca, caKey
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	keyDer, _ := x509.MarshalECPrivateKey(key)
+	certFile := filepath.Join(dir, name+".crt")
+	keyFile := filepath.Join(dir, name+".key")
+	_ = os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600)
+	_ = os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0600)
+	return cert, key, certFile, keyFile
+}
+
+func TestSocketLoggerTLS(t *testing.T) {
+	dir := t.TempDir()
+	ca, caKey, caFile, _ := writeTestCert(t, dir, "ca", nil, nil, true)
+	_, _, serverCert, serverKey := writeTestCert(t, dir, "localhost", ca, caKey, false)
+	_, _, clientCert, clientKey := writeTestCert(t, dir, "client", ca, caKey, false)
+	pool := x509.NewCertPool()
+	pool.AddCert(ca)
+	cert, err := tls.LoadX509KeyPair(serverCert, serverKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ln, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		ClientCAs:    pool,
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		MinVersion:   tls.VersionTLS12,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	_, port, _ := net.SplitHostPort(ln.Addr().String())
+
+	cfg := GetDefaultConfig()
+	cfg.FileLogger = false
+	cfg.ConsoleLogger = false
+	cfg.SocketLoggerEnable = true
+	cfg.SocketLoggerJSON = true
+	cfg.SocketType = "tls"
+	cfg.SocketPort = port
+	cfg.SocketTLSCA = caFile
+	cfg.SocketTLSCert = clientCert
+	cfg.SocketTLSKey = clientKey
+	cfg.SocketTLSServer = "localhost"
+	cfg.SocketTLSMinVer = "1.3"
+	accepted := make(chan net.Conn, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err == nil && conn.(*tls.Conn).Handshake() == nil {
+			accepted <- conn
+		}
+	}()
+	if err := InitLog(cfg); err != nil {
+		t.Fatal(err)
+	}
+	defer InitLog(GetDefaultConfig())
+	Info("over tls")
+	conn := <-accepted
+	defer conn.Close()
+	_ = conn.SetReadDeadline(time.Now().Add(time.Second))
+	line, err := bufio.NewReader(conn).ReadString('\n')
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(line, `"msg":"over tls"`) {
+		t.Fatalf("unexpected line %q", line)
+	}
+	if v := conn.(*tls.Conn).ConnectionState().Version; v != tls.VersionTLS13 {
+		t.Fatalf("unexpected tls version %x", v)
+	}
+}
@@ -0,0 +1,96 @@
+//go:build !windows
+
+package zlog
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSocketLoggerUnix(t *testing.T) {
+	dir, err := os.MkdirTemp("", "zlog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "agent.sock")
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	cfg := GetDefaultConfig()
+	cfg.FileLogger = false
+	cfg.ConsoleLogger = false
+	cfg.SocketLoggerEnable = true
+	cfg.SocketLoggerJSON = true
+	cfg.SocketType = "unix"
+	cfg.SocketPath = path
+	if err := InitLog(cfg); err != nil {
+		t.Fatal(err)
+	}
+	defer InitLog(GetDefaultConfig())
+	conn, err := ln.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	Info("over unix")
+	_ = conn.SetReadDeadline(time.Now().Add(time.Second))
+	line, err := bufio.NewReader(conn).ReadString('\n')
+	if err != nil || !strings.Contains(line, `"msg":"over unix"`) {
+		t.Fatalf("unexpected line %q %v", line, err)
+	}
+}
+
+func TestSocketLoggerUnixgram(t *testing.T) {
+	dir, err := os.MkdirTemp("", "zlog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "agent.sock")
+	listen := func() net.PacketConn {
+		pc, err := net.ListenPacket("unixgram", path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return pc
+	}
+	read := func(pc net.PacketConn) string {
+		buf := make([]byte, 4096)
+		_ = pc.SetReadDeadline(time.Now().Add(time.Second))
+		n, _, err := pc.ReadFrom(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(buf[:n])
+	}
+	pc := listen()
+	logger, err := New(WithSocket("unixgram", path))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer logger.Close(context.Background())
+	logger.Info("first")
+	if msg := read(pc); !strings.Contains(msg, "first") {
+		t.Fatalf("unexpected datagram %q", msg)
+	}
+	// agent 重启后重新连接
+	pc.Close()
+	os.Remove(path)
+	logger.Info("lost")
+	pc = listen()
+	defer pc.Close()
+	logger.Info("again")
+	if msg := read(pc); !strings.Contains(msg, "again") {
+		t.Fatalf("unexpected datagram %q", msg)
+	}
+}
@@ -0,0 +1,324 @@
+// @Author: openownworld
+// @Email:  openownworld@163.com
+// @File:   syslog.go
+// @Description: syslog 输出，RFC 5424 / RFC 3164 格式，/dev/log udp tcp tls
+
+package zlog
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.uber.org/zap/zapcore"
+)
+
+// Enums syslog format constants.
+const (
+	SyslogRFC5424 = "rfc5424"
+	SyslogRFC3164 = "rfc3164"
+)
+
+const (
+	defaultSyslogAddr = "/dev/log"
+	defaultSyslogSDID = "zlog@32473" // 32473 为文档示例用的私有企业号
+)
+
+// syslogFacilities facility 名称
+var syslogFacilities = map[string]int{
+	"kern": 0, "user": 1, "mail": 2, "daemon": 3, "auth": 4, "syslog": 5, "lpr": 6, "news": 7,
+	"uucp": 8, "cron": 9, "authpriv": 10, "ftp": 11,
+	"local0": 16, "local1": 17, "local2": 18, "local3": 19,
+	"local4": 20, "local5": 21, "local6": 22, "local7": 23,
+}
+
+// syslogSeverities zap 级别对应的 syslog severity
+var syslogSeverities = map[zapcore.Level]int{
+	zapcore.DebugLevel:  7, // debug
+	zapcore.InfoLevel:   6, // informational
+	zapcore.WarnLevel:   4, // warning
+	zapcore.ErrorLevel:  3, // err
+	zapcore.DPanicLevel: 2, // crit
+	zapcore.PanicLevel:  1, // alert
+	zapcore.FatalLevel:  0, // emerg
+}
+
+// SyslogOptions syslog 输出选项
+type SyslogOptions struct {
+	Network  string        // unixgram unix udp tcp tls，默认 unixgram
+	Addr     string        // 地址，unix 类型默认 /dev/log
+	Format   string        // rfc5424 rfc3164，默认 rfc5424
+	Facility string        // facility 名称，默认 user
+	AppName  string        // APP-NAME / TAG，默认进程名
+	ProcID   string        // PROCID，默认进程号
+	MsgID    string        // MSGID，默认 -
+	Hostname string        // HOSTNAME，默认 os.Hostname
+	SDID     string        // 结构化数据 SD-ID，默认 zlog@32473
+	Stream   StreamOptions // tcp tls unix 的重连、缓存与 tls 配置，默认 octet 分帧，newline 分帧时消息中的换行转义为 #012
+}
+
+// syslogCore 按 syslog 格式编码 zap 日志，字段写入 RFC 5424 结构化数据
+type syslogCore struct {
+	zapcore.LevelEnabler
+	opts     SyslogOptions
+	facility int
+	newline  bool // 流式传输按换行分帧，消息和堆栈中的换行需要转义
+	w        io.Writer
+	fields   []zapcore.Field
+}
+
+// NewSyslogCore 创建 syslog 输出 core，返回的 io.Closer 用于关闭连接
+func NewSyslogCore(opts SyslogOptions) (zapcore.Core, io.Closer, error) {
+	if opts.Network == "" {
+		opts.Network = "unixgram"
+	}
+	opts.Network = strings.ToLower(opts.Network)
+	if opts.Addr == "" && isUnixSocket(opts.Network) {
+		opts.Addr = defaultSyslogAddr
+	}
+	if opts.Addr == "" {
+		return nil, nil, fmt.Errorf("syslog addr is required for network %s", opts.Network)
+	}
+	if opts.Format == "" {
+		opts.Format = SyslogRFC5424
+	}
+	opts.Format = strings.ToLower(opts.Format)
+	if opts.Format != SyslogRFC5424 && opts.Format != SyslogRFC3164 {
+		return nil, nil, fmt.Errorf("unknown syslog format %q, want rfc5424 or rfc3164", opts.Format)
+	}
+	if opts.Facility == "" {
+		opts.Facility = "user"
+	}
+	facility, ok := syslogFacilities[strings.ToLower(opts.Facility)]
+	if !ok {
+		return nil, nil, fmt.Errorf("unknown syslog facility %q", opts.Facility)
+	}
+	if opts.AppName == "" {
+		opts.AppName = filepath.Base(os.Args[0])
+	}
+	if opts.ProcID == "" {
+		opts.ProcID = strconv.Itoa(os.Getpid())
+	}
+	if opts.Hostname == "" {
+		opts.Hostname, _ = os.Hostname()
+	}
+	if opts.SDID == "" {
+		opts.SDID = defaultSyslogSDID
+	}
+	var w io.WriteCloser
+	newline := false
+	switch opts.Network {
+	case "unixgram", "udp":
+		w = NewDatagramWriter(opts.Network, opts.Addr)
+	case "unix", "tcp", "tls":
+		// RFC 6587 RFC 5425 流式传输使用 octet counting，堆栈等多行消息不会被拆成多条
+		if opts.Stream.Framing == "" {
+			opts.Stream.Framing = FramingOctet
+		}
+		newline = strings.EqualFold(opts.Stream.Framing, FramingNewline)
+		if opts.Network == "tls" {
+			w = NewTLSWriter(opts.Addr, opts.Stream)
+		} else {
+			w = NewStreamWriter(opts.Network, opts.Addr, opts.Stream)
+		}
+	default:
+		return nil, nil, fmt.Errorf("unsupported syslog network %q", opts.Network)
+	}
+	return &syslogCore{LevelEnabler: zapcore.DebugLevel, opts: opts, facility: facility, newline: newline, w: w}, w, nil
+}
+
+// With implements zapcore.Core.
+func (c *syslogCore) With(fields []zapcore.Field) zapcore.Core {
+	n := *c
+	n.fields = make([]zapcore.Field, 0, len(c.fields)+len(fields))
+	n.fields = append(n.fields, c.fields...)
+	n.fields = append(n.fields, fields...)
+	return &n
+}
+
+// Check implements zapcore.Core.
+func (c *syslogCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(ent.Level) {
+		return ce.AddCore(ent, c)
+	}
+	return ce
+}
+
+// Write implements zapcore.Core.
+func (c *syslogCore) Write(ent zapcore.Entry, fields []zapcore.Field) error {
+	enc := zapcore.NewMapObjectEncoder()
+	for _, f := range c.fields {
+		f.AddTo(enc)
+	}
+	for _, f := range fields {
+		f.AddTo(enc)
+	}
+	if ent.LoggerName != "" {
+		enc.Fields["name"] = ent.LoggerName
+	}
+	if ent.Caller.Defined {
+		enc.Fields["caller"] = ent.Caller.TrimmedPath()
+	}
+	pri := c.facility*8 + syslogSeverities[ent.Level]
+	var msg string
+	if c.opts.Format == SyslogRFC3164 {
+		msg = c.rfc3164(pri, ent, enc.Fields)
+	} else {
+		msg = c.rfc5424(pri, ent, enc.Fields)
+	}
+	if c.newline {
+		// 与 rsyslog 一致，控制字符换行转义为 #012
+		msg = strings.ReplaceAll(msg, "\n", "#012")
+	}
+	_, err := c.w.Write([]byte(msg))
+	return err
+}
+
+// Sync implements zapcore.Core.
+func (c *syslogCore) Sync() error {
+	return nil
+}
+
+// rfc5424 <PRI>1 TIMESTAMP HOSTNAME APP-NAME PROCID MSGID [SD-ID key="value"] MSG
+func (c *syslogCore) rfc5424(pri int, ent zapcore.Entry, fields map[string]interface{}) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "<%d>1 %s %s %s %s %s ", pri, ent.Time.Format("2006-01-02T15:04:05.000000Z07:00"),
+		syslogHeader(c.opts.Hostname, 255), syslogHeader(c.opts.AppName, 48),
+		syslogHeader(c.opts.ProcID, 128), syslogHeader(c.opts.MsgID, 32))
+	if len(fields) == 0 {
+		b.WriteString("-")
+	} else {
+		b.WriteString("[")
+		b.WriteString(c.opts.SDID)
+		for _, k := range sortedKeys(fields) {
+			b.WriteString(" ")
+			b.WriteString(sdName(k))
+			b.WriteString(`="`)
+			b.WriteString(sdEscape(fieldString(fields[k])))
+			b.WriteString(`"`)
+		}
+		b.WriteString("]")
+	}
+	b.WriteString(" ")
+	b.WriteString(ent.Message)
+	if ent.Stack != "" {
+		b.WriteString("\n")
+		b.WriteString(ent.Stack)
+	}
+	return b.String()
+}
+
+// rfc3164 <PRI>Mmm dd hh:mm:ss HOSTNAME TAG[PID]: MSG key=value，没有结构化数据，字段追加在消息后
+func (c *syslogCore) rfc3164(pri int, ent zapcore.Entry, fields map[string]interface{}) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "<%d>%s %s %s[%s]: %s", pri, ent.Time.Format(time.Stamp),
+		syslogHeader(c.opts.Hostname, 255), syslogHeader(c.opts.AppName, 32), c.opts.ProcID, ent.Message)
+	for _, k := range sortedKeys(fields) {
+		fmt.Fprintf(&b, " %s=%s", k, strconv.Quote(fieldString(fields[k])))
+	}
+	if ent.Stack != "" {
+		b.WriteString("\n")
+		b.WriteString(ent.Stack)
+	}
+	return b.String()
+}
+
+// syslogHeader 头部字段只允许可见 ASCII，为空时用 -
+func syslogHeader(s string, max int) string {
+	s = strings.Map(func(r rune) rune {
+		if r < 33 || r > 126 {
+			return '_'
+		}
+		return r
+	}, s)
+	if s == "" {
+		return "-"
+	}
+	if len(s) > max {
+		s = s[:max]
+	}
+	return s
+}
+
+// sdName SD-NAME 不允许 = 空格 ] " 最长 32
+func sdName(s string) string {
+	s = strings.Map(func(r rune) rune {
+		if r < 33 || r > 126 || r == '=' || r == ']' || r == '"' {
+			return '_'
+		}
+		return r
+	}, s)
+	if len(s) > 32 {
+		s = s[:32]
+	}
+	return s
+}
+
+// sdEscape PARAM-VALUE 中 " \ ] 需要转义
+func sdEscape(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, `]`, `\]`).Replace(s)
+}
+
+// fieldString 字段值转字符串，复合类型编码为 json
+func fieldString(v interface{}) string {
+	switch x := v.(type) {
+	case string:
+		return x
+	case fmt.Stringer:
+		return x.String()
+	case error:
+		return x.Error()
+	case bool, int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64, float32, float64:
+		return fmt.Sprint(x)
+	default:
+		b, err := json.Marshal(x)
+		if err != nil {
+			return fmt.Sprint(x)
+		}
+		return string(b)
+	}
+}
+
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// newConfigSyslogCore 按 Config 创建 syslog 输出，tls 使用 socketTLS* 证书配置
+func newConfigSyslogCore(logConfig Config) (zapcore.Core, io.Closer, error) {
+	opts := SyslogOptions{
+		Network:  logConfig.SyslogNetwork,
+		Addr:     logConfig.SyslogAddr,
+		Format:   logConfig.SyslogFormat,
+		Facility: logConfig.SyslogFacility,
+		AppName:  logConfig.SyslogAppName,
+		ProcID:   logConfig.SyslogProcID,
+		MsgID:    logConfig.SyslogMsgID,
+		Stream:   StreamOptions{BufferSize: logConfig.SocketBufferSize},
+	}
+	if opts.AppName == "" {
+		opts.AppName = logConfig.ServiceName
+	}
+	if strings.EqualFold(opts.Network, "tls") {
+		c, err := configTLS(logConfig)
+		if err != nil {
+			return nil, nil, fmt.Errorf("syslog: %v", err)
+		}
+		opts.Stream.TLS = c
+	}
+	c, closer, err := NewSyslogCore(opts)
+	if err != nil {
+		return nil, nil, fmt.Errorf("syslog: %v", err)
+	}
+	return c, closer, nil
+}
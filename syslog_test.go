@@ -0,0 +1,74 @@
+package zlog
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"regexp"
+	"testing"
+	"time"
+)
+
+func TestSyslogRFC5424UDP(t *testing.T) {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pc.Close()
+	logger, err := New(WithSyslog(SyslogOptions{Network: "udp", Addr: pc.LocalAddr().String(),
+		Facility: "local0", AppName: "app", ProcID: "42", Hostname: "host"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer logger.Close(context.Background())
+	logger.With(Field{Key: "user", Value: `a"b]`}).Warn("hello syslog")
+
+	buf := make([]byte, 4096)
+	_ = pc.SetReadDeadline(time.Now().Add(time.Second))
+	n, _, err := pc.ReadFrom(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// local0*8 + warning = 132
+	re := regexp.MustCompile(`^<132>1 \S+ host app 42 - \[zlog@32473 caller="\S+" user="a\\"b\\]"\] hello syslog$`)
+	if !re.Match(buf[:n]) {
+		t.Fatalf("unexpected message %q", buf[:n])
+	}
+}
+
+func TestSyslogRFC3164TCP(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	logger, err := New(WithSyslog(SyslogOptions{Network: "tcp", Addr: ln.Addr().String(), Format: SyslogRFC3164,
+		AppName: "app", ProcID: "42", Hostname: "host", Stream: StreamOptions{Framing: FramingNewline}}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer logger.Close(context.Background())
+	conn, err := ln.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	logger.WithField("free", 0).Error("disk full")
+	logger.Error("multi\nline")
+
+	_ = conn.SetReadDeadline(time.Now().Add(time.Second))
+	r := bufio.NewReader(conn)
+	line, err := r.ReadString('\n')
+	if err != nil {
+		t.Fatal(err)
+	}
+	// user*8 + err = 11
+	re := regexp.MustCompile(`^<11>\w{3} [ \d]\d \d{2}:\d{2}:\d{2} host app\[42\]: disk full caller="\S+" free="0"\n$`)
+	if !re.MatchString(line) {
+		t.Fatalf("unexpected message %q", line)
+	}
+	// newline 分帧时换行被转义，一条日志仍为一行
+	if line, err = r.ReadString('\n'); err != nil || !regexp.MustCompile(`app\[42\]: multi#012line caller=`).MatchString(line) {
+		t.Fatalf("unexpected message %q %v", line, err)
+	}
+}
@@ -0,0 +1,270 @@
+// @Author: openownworld
+// @Email:  openownworld@163.com
+// @File:   validate.go
+// @Description: Config 校验
+
+package zlog
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"text/template"
+)
+
+// socketTypes 支持的 SocketType，为空按 udp 处理
+var socketTypes = map[string]bool{
+	"":    true,
+	"udp": true,
+	"tcp": true,
+	"tls": true,
+	// unix domain socket 使用 SocketPath
+	"unix":     true,
+	"unixgram": true,
+}
+
+// timeFormats 支持的 TimeFormat，为空按 custom 处理
+var timeFormats = map[string]bool{
+	"":             true,
+	"custom":       true,
+	"iso8601":      true,
+	"rfc3339":      true,
+	"seconds":      true,
+	"milliseconds": true,
+	"nanoseconds":  true,
+}
+
+func isUnixSocket(socketType string) bool {
+	t := strings.ToLower(socketType)
+	return t == "unix" || t == "unixgram"
+}
+
+// errorFileLevels 支持的 ErrorFileLevel，为空按 warn 处理
+var errorFileLevels = map[string]bool{
+	"":      true,
+	"warn":  true,
+	"error": true,
+	"panic": true,
+	"fatal": true,
+}
+
+// Validate 校验 Config，返回包含所有无效或矛盾配置项的 error
+func (c Config) Validate() error {
+	var errs []error
+	add := func(format string, args ...interface{}) {
+		errs = append(errs, fmt.Errorf(format, args...))
+	}
+	if _, ok := Levels[c.Level]; !ok {
+		add("level: unknown level %q", c.Level)
+	}
+	if _, ok := Levels[c.StacktraceLevel]; !ok {
+		add("stacktraceLevel: unknown level %q", c.StacktraceLevel)
+	}
+	if !errorFileLevels[c.ErrorFileLevel] {
+		add("errorFileLevel: unknown level %q, want warn, error, panic or fatal", c.ErrorFileLevel)
+	}
+	if c.ServiceKey != "" && c.ServiceName == "" {
+		add("serviceKey: %q is set without serviceName", c.ServiceKey)
+	}
+	if tf := strings.ToLower(c.TimeFormat); !timeFormats[tf] {
+		add("timeFormat: unknown format %q, want custom, iso8601, rfc3339, seconds, milliseconds or nanoseconds", c.TimeFormat)
+	} else if c.CustomTimeEnable && tf != "" && tf != "custom" {
+		add("customTimeEnable: true contradicts timeFormat %q", c.TimeFormat)
+	}
+	if c.MaxSize < 0 {
+		add("maxSize: must not be negative, got %d", c.MaxSize)
+	}
+	if c.MaxBackups < 0 {
+		add("maxBackups: must not be negative, got %d", c.MaxBackups)
+	}
+	if c.MaxDays < 0 {
+		add("maxDays: must not be negative, got %d", c.MaxDays)
+	}
+	if _, ok := rotateLayouts[strings.ToLower(c.RotatePeriod)]; !ok && c.RotatePeriod != "" && !strings.EqualFold(c.RotatePeriod, RotateSize) {
+		add("rotatePeriod: unknown period %q, want size, hourly or daily", c.RotatePeriod)
+	}
+	if c.MaxTotalSize < 0 {
+		add("maxTotalSize: must not be negative, got %d", c.MaxTotalSize)
+	} else if c.MaxTotalSize > 0 && c.MaxTotalSize < c.MaxSize*2 {
+		add("maxTotalSize: must be at least twice maxSize %d, got %d", c.MaxSize, c.MaxTotalSize)
+	}
+	if c.MinFreeDisk < 0 {
+		add("minFreeDisk: must not be negative, got %d", c.MinFreeDisk)
+	}
+	if c.FileLogger && c.LogFileName == "" {
+		add("logFileName: is required when fileLogger is enabled")
+	}
+	if c.ErrorFileEnable {
+		if !c.FileLogger {
+			add("errorFileEnable: requires fileLogger to be enabled")
+		}
+		if c.ErrorFileName == "" {
+			add("errorFileName: is required when errorFileEnable is enabled")
+		} else if c.ErrorFileName == c.LogFileName {
+			add("errorFileName: must differ from logFileName %q", c.LogFileName)
+		}
+	}
+	if c.FileAsync || c.ConsoleAsync || c.SocketAsync {
+		if !asyncPolicies[strings.ToLower(c.AsyncPolicy)] {
+			add("asyncPolicy: unknown policy %q, want block, drop_newest, drop_oldest or drop_below_level", c.AsyncPolicy)
+		}
+		if _, ok := LevelNames[strings.ToLower(c.AsyncDropLevel)]; !ok && c.AsyncDropLevel != "" {
+			add("asyncDropLevel: unknown level %q", c.AsyncDropLevel)
+		}
+		if c.AsyncBufferSize < 0 {
+			add("asyncBufferSize: must not be negative, got %d", c.AsyncBufferSize)
+		}
+		if c.AsyncFlushInterval < 0 {
+			add("asyncFlushInterval: must not be negative, got %d", c.AsyncFlushInterval)
+		}
+	}
+	if c.SocketLoggerEnable {
+		if !socketTypes[strings.ToLower(c.SocketType)] {
+			add("socketType: unsupported socket type %q", c.SocketType)
+		}
+		if isUnixSocket(c.SocketType) {
+			if c.SocketPath == "" {
+				add("socketPath: is required when socketType is %s", c.SocketType)
+			}
+		} else {
+			if c.SocketIP == "" {
+				add("socketIP: is required when socketLoggerEnable is enabled")
+			}
+			if port, err := strconv.Atoi(c.SocketPort); err != nil || port <= 0 || port > 65535 {
+				add("socketPort: invalid port %q", c.SocketPort)
+			}
+		}
+		if !socketFramings[strings.ToLower(c.SocketFraming)] {
+			add("socketFraming: unknown framing %q, want newline, octet or null", c.SocketFraming)
+		}
+		if strings.EqualFold(c.SocketType, "tls") {
+			if (c.SocketTLSCert == "") != (c.SocketTLSKey == "") {
+				add("socketTLSCert: socketTLSCert and socketTLSKey must be set together")
+			}
+			if _, ok := tlsVersions[c.SocketTLSMinVer]; !ok {
+				add("socketTLSMinVer: unknown tls version %q, want 1.0, 1.1, 1.2 or 1.3", c.SocketTLSMinVer)
+			}
+		}
+		if c.SocketBufferSize < 0 {
+			add("socketBufferSize: must not be negative, got %d", c.SocketBufferSize)
+		}
+	}
+	if c.SyslogEnable {
+		switch strings.ToLower(c.SyslogNetwork) {
+		case "", "unixgram", "unix":
+		case "udp", "tcp", "tls":
+			if c.SyslogAddr == "" {
+				add("syslogAddr: is required when syslogNetwork is %s", c.SyslogNetwork)
+			}
+		default:
+			add("syslogNetwork: unsupported network %q", c.SyslogNetwork)
+		}
+		switch strings.ToLower(c.SyslogFormat) {
+		case "", SyslogRFC5424, SyslogRFC3164:
+		default:
+			add("syslogFormat: unknown format %q, want rfc5424 or rfc3164", c.SyslogFormat)
+		}
+		if _, ok := syslogFacilities[strings.ToLower(c.SyslogFacility)]; !ok && c.SyslogFacility != "" {
+			add("syslogFacility: unknown facility %q", c.SyslogFacility)
+		}
+	}
+	if c.GELFEnable {
+		if c.GELFAddr == "" {
+			add("gelfAddr: is required when gelfEnable is enabled")
+		}
+		network := strings.ToLower(c.GELFNetwork)
+		compression := strings.ToLower(c.GELFCompression)
+		switch network {
+		case "", "udp":
+			switch compression {
+			case "", GELFCompressGzip, GELFCompressZlib, GELFCompressNone:
+			default:
+				add("gelfCompression: unknown compression %q, want gzip, zlib or none", c.GELFCompression)
+			}
+		case "tcp", "tls":
+			if compression != "" && compression != GELFCompressNone {
+				add("gelfCompression: compression is not supported when gelfNetwork is %s", c.GELFNetwork)
+			}
+		default:
+			add("gelfNetwork: unsupported network %q", c.GELFNetwork)
+		}
+	}
+	if c.FluentEnable {
+		if c.FluentAddr == "" {
+			add("fluentAddr: is required when fluentEnable is enabled")
+		}
+		switch strings.ToLower(c.FluentNetwork) {
+		case "", "tcp", "tls", "unix":
+		default:
+			add("fluentNetwork: unsupported network %q", c.FluentNetwork)
+		}
+	}
+	if c.LokiEnable {
+		if u, err := url.Parse(c.LokiURL); err != nil || u.Scheme == "" || u.Host == "" {
+			add("lokiURL: invalid url %q", c.LokiURL)
+		}
+		switch strings.ToLower(c.LokiFormat) {
+		case "", LokiProtobuf, LokiJSON:
+		default:
+			add("lokiFormat: unknown format %q, want protobuf or json", c.LokiFormat)
+		}
+	}
+	if c.ElasticEnable {
+		if u, err := url.Parse(c.ElasticURL); err != nil || u.Scheme == "" || u.Host == "" {
+			add("elasticURL: invalid url %q", c.ElasticURL)
+		}
+		if c.ElasticUsername != "" && c.ElasticAPIKey != "" {
+			add("elasticAPIKey: elasticUsername and elasticAPIKey are mutually exclusive")
+		}
+	}
+	if c.OTLPEnable {
+		if u, err := url.Parse(c.OTLPEndpoint); err != nil || u.Scheme == "" || u.Host == "" {
+			add("otlpEndpoint: invalid url %q", c.OTLPEndpoint)
+		}
+		switch strings.ToLower(c.OTLPEncoding) {
+		case "", OTLPProtobuf, OTLPJSON:
+		default:
+			add("otlpEncoding: unknown encoding %q, want protobuf or json", c.OTLPEncoding)
+		}
+	}
+	if c.KafkaEnable {
+		if strings.TrimSpace(strings.ReplaceAll(c.KafkaBrokers, ",", "")) == "" {
+			add("kafkaBrokers: is required when kafkaEnable is enabled")
+		}
+		if c.KafkaTopic == "" {
+			add("kafkaTopic: is required when kafkaEnable is enabled")
+		}
+		if _, ok := kafkaAcks[strings.ToLower(c.KafkaAcks)]; !ok {
+			add("kafkaAcks: unknown acks %q, want 0, 1 or all", c.KafkaAcks)
+		}
+		if _, ok := kafkaCodecs[strings.ToLower(c.KafkaCompression)]; !ok {
+			add("kafkaCompression: unknown compression %q, want none or gzip", c.KafkaCompression)
+		}
+	}
+	if c.WebhookEnable {
+		if u, err := url.Parse(c.WebhookURL); err != nil || u.Scheme == "" || u.Host == "" {
+			add("webhookURL: invalid url %q", c.WebhookURL)
+		}
+		if _, ok := LevelNames[strings.ToLower(c.WebhookLevel)]; !ok && c.WebhookLevel != "" {
+			add("webhookLevel: unknown level %q", c.WebhookLevel)
+		}
+		switch strings.ToLower(c.WebhookFormat) {
+		case "", WebhookJSON, WebhookNDJSON:
+		case WebhookTemplate:
+			if _, err := template.New("webhook").Funcs(webhookFuncs).Parse(c.WebhookTemplate); err != nil {
+				add("webhookTemplate: %v", err)
+			}
+		default:
+			add("webhookFormat: unknown format %q, want json, ndjson or template", c.WebhookFormat)
+		}
+		if c.WebhookMaxEntries < 0 {
+			add("webhookMaxEntries: must not be negative, got %d", c.WebhookMaxEntries)
+		}
+		if c.WebhookConcurrency < 0 {
+			add("webhookConcurrency: must not be negative, got %d", c.WebhookConcurrency)
+		}
+	}
+	return errors.Join(errs...)
+}
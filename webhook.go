@@ -0,0 +1,338 @@
+// @Author: openownworld
+// @Email:  openownworld@163.com
+// @File:   webhook.go
+// @Description: http webhook 输出，分批 POST 到任意地址，json 数组、ndjson 或 text/template 模板，支持 bearer basic hmac 签名
+
+package zlog
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"text/template"
+
+	"go.uber.org/zap/zapcore"
+)
+
+// Enums webhook format constants.
+const (
+	WebhookJSON     = "json"     // json 数组 [{...},{...}]
+	WebhookNDJSON   = "ndjson"   // 每行一条 json
+	WebhookTemplate = "template" // text/template 模板
+)
+
+const defaultWebhookSignatureHeader = "X-Signature-256"
+
+// WebhookOptions http webhook 输出选项
+type WebhookOptions struct {
+	URL             string       // webhook 地址
+	Method          string       // 默认 POST
+	Header          http.Header  // 额外的请求头
+	BearerToken     string       // Authorization: Bearer
+	Username        string       // basic 认证
+	Password        string       // basic 认证
+	HMACSecret      string       // 不为空时对请求体做 HMAC-SHA256 签名，十六进制写入 SignatureHeader，前缀 sha256=
+	SignatureHeader string       // 签名请求头，默认 X-Signature-256
+	Format          string       // json ndjson template，默认 json
+	Template        string       // Format 为 template 时的 text/template 模板，.Entries 为本次请求的日志，json 函数编码为 json
+	ContentType     string       // 默认 json 和 template 为 application/json，ndjson 为 application/x-ndjson
+	Level           Level        // 最低级别，如 LevelError 只发送告警，默认全部
+	MaxEntries      int          // 每个请求最多条数，一批按此拆分为多个请求，默认整批一个请求
+	Concurrency     int          // 同时发送的请求数，默认 1
+	Client          *http.Client // 默认超时 10s 的 http.Client
+	Batch           BatchOptions // 分批、缓存与重试
+}
+
+// webhookPayload 模板数据，Entries 为 json 解码后的日志，数字为 json.Number
+type webhookPayload struct {
+	Entries []map[string]interface{}
+}
+
+var webhookFuncs = template.FuncMap{
+	"json": func(v interface{}) (string, error) {
+		b, err := json.Marshal(v)
+		return string(b), err
+	},
+}
+
+// WebhookClient 分批发送到 webhook，429 5xx 和网络错误按指数退避重试，其他状态码丢弃
+type WebhookClient struct {
+	opts WebhookOptions
+	url  string
+	tmpl *template.Template
+	b    *batcher[[]byte]
+}
+
+// NewWebhookClient 创建 webhook 输出
+func NewWebhookClient(opts WebhookOptions) (*WebhookClient, error) {
+	u, err := url.Parse(opts.URL)
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return nil, fmt.Errorf("invalid webhook url %q", opts.URL)
+	}
+	if opts.Method == "" {
+		opts.Method = http.MethodPost
+	}
+	if opts.SignatureHeader == "" {
+		opts.SignatureHeader = defaultWebhookSignatureHeader
+	}
+	if opts.Concurrency <= 0 {
+		opts.Concurrency = 1
+	}
+	if opts.Client == nil {
+		opts.Client = &http.Client{Timeout: defaultHTTPTimeout}
+	}
+	c := &WebhookClient{opts: opts, url: u.String()}
+	switch strings.ToLower(opts.Format) {
+	case "", WebhookJSON:
+		c.opts.Format = WebhookJSON
+	case WebhookNDJSON:
+		c.opts.Format = WebhookNDJSON
+	case WebhookTemplate:
+		c.opts.Format = WebhookTemplate
+		if c.tmpl, err = template.New("webhook").Funcs(webhookFuncs).Option("missingkey=zero").Parse(opts.Template); err != nil {
+			return nil, fmt.Errorf("webhook template: %v", err)
+		}
+	default:
+		return nil, fmt.Errorf("unknown webhook format %q, want json, ndjson or template", opts.Format)
+	}
+	if c.opts.ContentType == "" {
+		c.opts.ContentType = "application/json"
+		if c.opts.Format == WebhookNDJSON {
+			c.opts.ContentType = "application/x-ndjson"
+		}
+	}
+	c.b = newBatcher("webhook "+u.Host, opts.Batch, c.send, nil)
+	return c, nil
+}
+
+// Sync 立即发送缓存的日志
+func (c *WebhookClient) Sync() error {
+	return c.b.sync()
+}
+
+// Close implements io.Closer. 尝试发送剩余日志后退出
+func (c *WebhookClient) Close() error {
+	return c.b.close()
+}
+
+// Dropped 缓存已满、超过重试次数或被拒绝而丢弃的日志条数
+func (c *WebhookClient) Dropped() uint64 {
+	return c.b.dropped.Load()
+}
+
+// send 按 MaxEntries 拆分为多个请求，最多 Concurrency 个同时发送，返回需要重试的条目下标
+func (c *WebhookClient) send(entries [][]byte) ([]int, error) {
+	size := c.opts.MaxEntries
+	if size <= 0 || size > len(entries) {
+		size = len(entries)
+	}
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		retry    []int
+		rejected [][]byte
+		errs     []error
+	)
+	sem := make(chan struct{}, c.opts.Concurrency)
+	for start := 0; start < len(entries); start += size {
+		end := min(start+size, len(entries))
+		sem <- struct{}{}
+		wg.Add(1)
+		go func() {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			err := c.post(entries[start:end])
+			if err == nil {
+				return
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			errs = append(errs, err)
+			var perr *permanentError
+			if errors.As(err, &perr) {
+				rejected = append(rejected, entries[start:end]...)
+				return
+			}
+			for i := start; i < end; i++ {
+				retry = append(retry, i)
+			}
+		}()
+	}
+	wg.Wait()
+	if len(rejected) > 0 {
+		c.b.reject(rejected, errors.Join(errs...))
+	}
+	if len(retry) > 0 {
+		return retry, errors.Join(errs...)
+	}
+	return nil, nil
+}
+
+// post 发送一个请求，模板执行失败不可重试
+func (c *WebhookClient) post(entries [][]byte) error {
+	body, err := c.render(entries)
+	if err != nil {
+		return &permanentError{err: err}
+	}
+	req, err := http.NewRequest(c.opts.Method, c.url, bytes.NewReader(body))
+	if err != nil {
+		return &permanentError{err: err}
+	}
+	for k, v := range c.opts.Header {
+		req.Header[k] = v
+	}
+	req.Header.Set("Content-Type", c.opts.ContentType)
+	if c.opts.BearerToken != "" {
+		req.Header.Set("Authorization", "Bearer "+c.opts.BearerToken)
+	}
+	if c.opts.Username != "" {
+		req.SetBasicAuth(c.opts.Username, c.opts.Password)
+	}
+	if c.opts.HMACSecret != "" {
+		req.Header.Set(c.opts.SignatureHeader, "sha256="+webhookSignature(c.opts.HMACSecret, body))
+	}
+	return postHTTP(c.opts.Client, req)
+}
+
+// render 按 Format 生成请求体
+func (c *WebhookClient) render(entries [][]byte) ([]byte, error) {
+	var buf bytes.Buffer
+	switch c.opts.Format {
+	case WebhookNDJSON:
+		for _, e := range entries {
+			buf.Write(e)
+			buf.WriteByte('\n')
+		}
+	case WebhookTemplate:
+		data := webhookPayload{Entries: make([]map[string]interface{}, len(entries))}
+		for i, e := range entries {
+			dec := json.NewDecoder(bytes.NewReader(e))
+			dec.UseNumber()
+			if err := dec.Decode(&data.Entries[i]); err != nil {
+				return nil, err
+			}
+		}
+		if err := c.tmpl.Execute(&buf, data); err != nil {
+			return nil, fmt.Errorf("webhook template: %v", err)
+		}
+	default:
+		buf.WriteByte('[')
+		for i, e := range entries {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			buf.Write(e)
+		}
+		buf.WriteByte(']')
+	}
+	return buf.Bytes(), nil
+}
+
+// webhookSignature 请求体的 HMAC-SHA256 十六进制签名
+func webhookSignature(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// webhookCore 使用 json 编码器编码日志，低于 Level 的日志不发送
+type webhookCore struct {
+	zapcore.LevelEnabler
+	enc zapcore.Encoder
+	c   *WebhookClient
+}
+
+// NewWebhookCore 创建 webhook 输出 core，enc 为空时使用与文件输出一致的 json 编码器(RFC 3339 时间)
+// 返回的 io.Closer 为 *WebhookClient，可通过 Dropped 获取丢弃条数
+func NewWebhookCore(opts WebhookOptions, enc zapcore.Encoder) (zapcore.Core, io.Closer, error) {
+	c, err := NewWebhookClient(opts)
+	if err != nil {
+		return nil, nil, err
+	}
+	if enc == nil {
+		enc = newEncoder(EncoderOption{formatter: "json", timeFmt: "rfc3339", shortCaller: true})
+	}
+	level, ok := levelToZapLevel[opts.Level]
+	if !ok {
+		level = zapcore.DebugLevel
+	}
+	return &webhookCore{LevelEnabler: level, enc: enc, c: c}, c, nil
+}
+
+// With implements zapcore.Core.
+func (c *webhookCore) With(fields []zapcore.Field) zapcore.Core {
+	n := *c
+	n.enc = c.enc.Clone()
+	for _, f := range fields {
+		f.AddTo(n.enc)
+	}
+	return &n
+}
+
+// Check implements zapcore.Core.
+func (c *webhookCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(ent.Level) {
+		return ce.AddCore(ent, c)
+	}
+	return ce
+}
+
+// Write implements zapcore.Core.
+func (c *webhookCore) Write(ent zapcore.Entry, fields []zapcore.Field) error {
+	buf, err := c.enc.EncodeEntry(ent, fields)
+	if err != nil {
+		return err
+	}
+	e := append([]byte(nil), bytes.TrimRight(buf.Bytes(), "\n")...)
+	buf.Free()
+	c.c.b.post(e, len(e))
+	return nil
+}
+
+// Sync implements zapcore.Core.
+func (c *webhookCore) Sync() error {
+	return c.c.Sync()
+}
+
+// newConfigWebhookCore 按 Config 创建 webhook 输出，webhookLevel 为空时使用 errorFileLevel
+func newConfigWebhookCore(logConfig Config) (zapcore.Core, io.Closer, error) {
+	opts := WebhookOptions{
+		URL:         logConfig.WebhookURL,
+		Header:      http.Header{},
+		BearerToken: logConfig.WebhookBearerToken,
+		Username:    logConfig.WebhookUsername,
+		Password:    logConfig.WebhookPassword,
+		HMACSecret:  logConfig.WebhookHMACSecret,
+		Format:      logConfig.WebhookFormat,
+		Template:    logConfig.WebhookTemplate,
+		MaxEntries:  logConfig.WebhookMaxEntries,
+		Concurrency: logConfig.WebhookConcurrency,
+	}
+	level := logConfig.WebhookLevel
+	if level == "" {
+		level = logConfig.ErrorFileLevel
+	}
+	opts.Level = LevelNames[strings.ToLower(level)]
+	for _, h := range strings.Split(logConfig.WebhookHeaders, ",") {
+		if k, v, ok := strings.Cut(h, ":"); ok && strings.TrimSpace(k) != "" {
+			opts.Header.Add(strings.TrimSpace(k), strings.TrimSpace(v))
+		}
+	}
+	enc := newEncoder(EncoderOption{formatter: "json", timeFmt: "rfc3339", shortCaller: logConfig.ShortCaller, function: logConfig.FunctionEnable})
+	c, closer, err := NewWebhookCore(opts, enc)
+	if err != nil {
+		return nil, nil, fmt.Errorf("webhook: %v", err)
+	}
+	return c, closer, nil
+}
@@ -0,0 +1,119 @@
+package zlog
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+func TestWebhookTemplate(t *testing.T) {
+	bodies := make(chan string, 10)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if r.Header.Get("Authorization") != "Bearer token" || r.Header.Get("Content-Type") != "application/json" ||
+			r.Header.Get("X-Signature-256") != "sha256="+webhookSignature("secret", body) {
+			t.Errorf("unexpected headers %v", r.Header)
+		}
+		bodies <- string(body)
+	}))
+	defer srv.Close()
+	logger, err := New(WithService("app"), WithWebhook(WebhookOptions{
+		URL:         srv.URL,
+		BearerToken: "token",
+		HMACSecret:  "secret",
+		Format:      WebhookTemplate,
+		Template:    `{{with index .Entries 0}}{"text":{{json (printf "[%s] %s %s" .level .service .msg)}}}{{end}}`,
+		Level:       LevelError,
+		MaxEntries:  1,
+		Concurrency: 2,
+		Batch:       BatchOptions{BatchSize: 2, FlushInterval: time.Hour},
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer logger.Close(context.Background())
+	logger.Info("ignored")
+	logger.Error("disk full")
+	logger.Error("db down")
+	var got []string
+	for len(got) < 2 {
+		select {
+		case b := <-bodies:
+			got = append(got, b)
+		case <-time.After(2 * time.Second):
+			t.Fatalf("timeout, got %v", got)
+		}
+	}
+	sort.Strings(got)
+	if got[0] != `{"text":"[error] app db down"}` || got[1] != `{"text":"[error] app disk full"}` {
+		t.Fatalf("unexpected bodies %v", got)
+	}
+}
+
+func TestWebhookRetry(t *testing.T) {
+	var calls atomic.Int32
+	bodies := make(chan []map[string]interface{}, 10)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		if user, pass, ok := r.BasicAuth(); !ok || user != "u" || pass != "p" {
+			t.Errorf("unexpected basic auth %q %q", user, pass)
+		}
+		var entries []map[string]interface{}
+		if err := json.NewDecoder(r.Body).Decode(&entries); err != nil {
+			t.Error(err)
+		}
+		bodies <- entries
+	}))
+	defer srv.Close()
+	core, closer, err := NewWebhookCore(WebhookOptions{URL: srv.URL, Username: "u", Password: "p",
+		Batch: BatchOptions{BatchSize: 2, FlushInterval: time.Hour, MinBackoff: time.Millisecond}}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer closer.Close()
+	logger := zap.New(core)
+	logger.Info("first")
+	logger.Warn("second", zap.Int("n", 2))
+	select {
+	case entries := <-bodies:
+		if len(entries) != 2 || entries[0]["msg"] != "first" || entries[1]["n"] != float64(2) {
+			t.Fatalf("unexpected entries %v", entries)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("timeout")
+	}
+	if calls.Load() != 2 {
+		t.Fatalf("unexpected calls %d", calls.Load())
+	}
+}
+
+func TestWebhookRejected(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "bad payload", http.StatusBadRequest)
+	}))
+	defer srv.Close()
+	core, closer, err := NewWebhookCore(WebhookOptions{URL: srv.URL, Format: WebhookNDJSON}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := closer.(*WebhookClient)
+	zap.New(core).Info("first")
+	if err := c.Sync(); err != nil {
+		t.Fatal(err)
+	}
+	if c.Dropped() != 1 {
+		t.Fatalf("dropped %d, want 1", c.Dropped())
+	}
+	_ = c.Close()
+}
@@ -5,20 +5,41 @@
 
 package zlog
 
+import "context"
+
 type zLogWrapper struct {
 	logger Logger
 }
 
+// unwrapZLogger 取出 NewZLogger New 等创建的 *zLogger，其他 Logger 实现返回 false
+func unwrapZLogger(logger Logger) (*zLogger, bool) {
+	if w, ok := logger.(*zLogWrapper); ok {
+		logger = w.logger
+	}
+	z, ok := logger.(*zLogger)
+	return z, ok
+}
+
 // Sync 在默认情况下，日志记录器是没有缓冲的。但是在进程退出之前调用 Sync() 方法是一个好习惯。
 func (z *zLogWrapper) Sync() error {
 	return z.logger.Sync()
 }
 
+// Close flushes and closes every output.
+func (z *zLogWrapper) Close(ctx context.Context) error {
+	return z.logger.Close(ctx)
+}
+
 // SetLevel set the output log level.
 func (z *zLogWrapper) SetLevel(level Level) {
 	z.logger.SetLevel(level)
 }
 
+// GetLevel get the output log level.
+func (z *zLogWrapper) GetLevel() Level {
+	return z.logger.GetLevel()
+}
+
 // Println 打印日志到终端
 // var buf strings.Builder
 // buf.WriteString(getNowTimeMs())
@@ -116,6 +137,11 @@ func (z *zLogWrapper) WithFields(fields map[string]interface{}) Logger {
 	return z.logger.WithFields(fields)
 }
 
+// Named adds a new path segment to the logger's name.
+func (z *zLogWrapper) Named(name string) Logger {
+	return z.logger.Named(name)
+}
+
 // Log 兼容 Kratos Logger 接口
 func (z *zLogWrapper) Log(level Level, keyvals ...any) error {
 	return z.logger.Log(level, keyvals...)
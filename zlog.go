@@ -17,6 +17,9 @@
 package zlog
 
 import (
+	"context"
+	"crypto/tls"
+	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
@@ -25,13 +28,12 @@ import (
 	"path"
 	"path/filepath"
 	"runtime"
+	"strings"
 	"sync"
 	"time"
 
-	"github.com/go-ini/ini"
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
-	"gopkg.in/natefinch/lumberjack.v2"
 )
 
 // Levels is the map from string to zapcore.Level.
@@ -54,12 +56,22 @@ var levelToZapLevel = map[Level]zapcore.Level{
 	LevelFatal: zapcore.FatalLevel,
 }
 
+var zapLevelToLevel = map[zapcore.Level]Level{
+	zapcore.DebugLevel: LevelDebug,
+	zapcore.InfoLevel:  LevelInfo,
+	zapcore.WarnLevel:  LevelWarn,
+	zapcore.ErrorLevel: LevelError,
+	zapcore.PanicLevel: LevelPanic,
+	zapcore.FatalLevel: LevelFatal,
+}
+
 var (
-	atomLevel      zap.AtomicLevel
-	callerSkipNum  = 2
-	consoleSkipNum = 3
-	defaultLogger  Logger
-	mtx            sync.RWMutex
+	replaceCloseTimeout = 5 * time.Second
+	callerSkipNum       = 2
+	consoleSkipNum      = 3
+	defaultLogger       Logger
+	defaultLazy         bool // defaultLogger 由 GetDefaultLogger 按默认配置创建
+	mtx                 sync.RWMutex
 )
 
 // Config 封装高性能日志库zap
@@ -68,21 +80,33 @@ var (
 type Config struct {
 	ServiceKey         string `ini:"serviceKey"`         // json service key
 	ServiceName        string `ini:"serviceName"`        // json service name
-	CustomTimeEnable   bool   `ini:"customTimeEnable"`   // custom time 2006-01-02 15:04:05.000
+	CustomTimeEnable   bool   `ini:"customTimeEnable"`   // custom time 2006-01-02 15:04:05.000，已由 timeFormat 取代，true 时 timeFormat 只能为空或 custom
+	TimeFormat         string `ini:"timeFormat"`         // file console socket 时间格式 custom iso8601 rfc3339 seconds milliseconds nanoseconds，默认 custom 2006-01-02 15:04:05.000
 	LogFileName        string `ini:"logFileName"`        // all日志输出路径文件名
 	ErrorFileName      string `ini:"errorFileName"`      // 错误日志分级复制输出路径文件名
 	MaxSize            int    `ini:"maxSize"`            // Mb 最大文件限制，最大文件数限制
 	MaxBackups         int    `ini:"maxBackups"`         // 最大文件数限制
 	MaxDays            int    `ini:"maxDays"`            // 最大天数保存
 	Compress           bool   `ini:"compress"`           // 启用日志压缩
+	RotatePeriod       string `ini:"rotatePeriod"`       // 切割周期 size hourly daily，hourly daily 文件名为 log.2006-01-02T15.log log.2006-01-02.log
+	MaxTotalSize       int    `ini:"maxTotalSize"`       // Mb logFileName errorFileName 及其备份的总大小，超出时删除最旧的备份，0 不限制
+	MinFreeDisk        int    `ini:"minFreeDisk"`        // Mb 磁盘剩余空间低于该值时文件只写 error 及以上级别，0 不检查
 	Level              string `ini:"level"`              // 日志级别
 	StacktraceLevel    string `ini:"stacktraceLevel"`    // 输出调用堆栈 级别
 	ErrorFileLevel     string `ini:"errorFileLevel"`     // 错误日志分级 级别
 	ShortCaller        bool   `ini:"shortCaller"`        // 文件名行号 log/log.go:127 or 全路径
 	FunctionEnable     bool   `ini:"functionEnable"`     // 函数路径 go-demo/libary/log.TestLogger
-	SocketType         string `ini:"socketType"`         // socket type UDP
+	SocketType         string `ini:"socketType"`         // socket type udp tcp tls unix unixgram
 	SocketIP           string `ini:"socketIP"`           // server dst ip
 	SocketPort         string `ini:"socketPort"`         // server dst port
+	SocketPath         string `ini:"socketPath"`         // unix unixgram socket 路径 /var/run/agent.sock
+	SocketFraming      string `ini:"socketFraming"`      // tcp 分帧 newline octet null
+	SocketBufferSize   int    `ini:"socketBufferSize"`   // tcp 断线期间最多缓存的日志条数
+	SocketTLSCA        string `ini:"socketTLSCA"`        // tls 校验服务端证书的 CA 文件
+	SocketTLSCert      string `ini:"socketTLSCert"`      // tls 客户端证书文件
+	SocketTLSKey       string `ini:"socketTLSKey"`       // tls 客户端私钥文件
+	SocketTLSServer    string `ini:"socketTLSServer"`    // tls 校验服务端证书的主机名，默认 socketIP
+	SocketTLSMinVer    string `ini:"socketTLSMinVer"`    // tls 最低版本 1.2 1.3
 	SocketLoggerEnable bool   `ini:"socketLoggerEnable"` // 启用 socket Logger
 	SocketLoggerJSON   bool   `ini:"socketLoggerJSON"`   // 启用 socket LoggerJSON
 	ErrorFileEnable    bool   `ini:"errorFileEnable"`    // 启用 错误日志分级复制输出
@@ -90,42 +114,126 @@ type Config struct {
 	FileLoggerJSON     bool   `ini:"fileLoggerJSON"`     // 启用 file LoggerJSON
 	ConsoleLogger      bool   `ini:"consoleLogger"`      // 启用 console Logger
 	ConsoleLoggerJSON  bool   `ini:"consoleLoggerJSON"`  // 启用 console LoggerJSON
+	FileAsync          bool   `ini:"fileAsync"`          // file 异步写入，logFileName errorFileName 各自一个队列
+	ConsoleAsync       bool   `ini:"consoleAsync"`       // console 异步写入
+	SocketAsync        bool   `ini:"socketAsync"`        // socket 异步写入
+	AsyncBufferSize    int    `ini:"asyncBufferSize"`    // 异步队列最多缓存的日志条数
+	AsyncPolicy        string `ini:"asyncPolicy"`        // 异步队列已满时 block drop_newest drop_oldest drop_below_level
+	AsyncDropLevel     string `ini:"asyncDropLevel"`     // drop_below_level 时丢弃低于该级别的日志
+	AsyncFlushInterval int    `ini:"asyncFlushInterval"` // 毫秒 定时 Sync 底层输出的间隔
+	SyslogEnable       bool   `ini:"syslogEnable"`       // 启用 syslog 输出
+	SyslogNetwork      string `ini:"syslogNetwork"`      // syslog unixgram unix udp tcp tls，tls 使用 socketTLS* 证书配置
+	SyslogAddr         string `ini:"syslogAddr"`         // syslog 地址，unix 类型默认 /dev/log
+	SyslogFormat       string `ini:"syslogFormat"`       // syslog rfc5424 rfc3164
+	SyslogFacility     string `ini:"syslogFacility"`     // syslog facility user local0 等
+	SyslogAppName      string `ini:"syslogAppName"`      // syslog APP-NAME，默认 serviceName 或进程名
+	SyslogProcID       string `ini:"syslogProcID"`       // syslog PROCID，默认进程号
+	SyslogMsgID        string `ini:"syslogMsgID"`        // syslog MSGID，默认 -
+	JournalEnable      bool   `ini:"journalEnable"`      // 启用 systemd-journald 输出，SYSLOG_IDENTIFIER 默认 serviceName
+	GELFEnable         bool   `ini:"gelfEnable"`         // 启用 Graylog GELF 输出
+	GELFNetwork        string `ini:"gelfNetwork"`        // gelf udp tcp tls，tls 使用 socketTLS* 证书配置
+	GELFAddr           string `ini:"gelfAddr"`           // gelf input 地址 127.0.0.1:12201
+	GELFCompression    string `ini:"gelfCompression"`    // gelf udp 压缩 gzip zlib none，默认 gzip，tcp tls 不压缩
+	FluentEnable       bool   `ini:"fluentEnable"`       // 启用 Fluentd / Fluent Bit forward 输出
+	FluentNetwork      string `ini:"fluentNetwork"`      // fluent tcp tls unix，tls 使用 socketTLS* 证书配置
+	FluentAddr         string `ini:"fluentAddr"`         // fluent forward 地址 127.0.0.1:24224，unix 为 socket 路径
+	FluentTag          string `ini:"fluentTag"`          // fluent tag，默认 serviceName
+	FluentRequireAck   bool   `ini:"fluentRequireAck"`   // fluent 每批等待服务端 ack
+	LokiEnable         bool   `ini:"lokiEnable"`         // 启用 Grafana Loki 输出
+	LokiURL            string `ini:"lokiURL"`            // loki 地址 http://127.0.0.1:3100
+	LokiFormat         string `ini:"lokiFormat"`         // loki protobuf json
+	LokiLabels         string `ini:"lokiLabels"`         // loki 作为 label 的字段，逗号分隔，默认 service,level,logger
+	LokiTenantID       string `ini:"lokiTenantID"`       // loki 多租户 X-Scope-OrgID
+	ElasticEnable      bool   `ini:"elasticEnable"`      // 启用 Elasticsearch / OpenSearch _bulk 输出
+	ElasticURL         string `ini:"elasticURL"`         // elastic 地址 http://127.0.0.1:9200
+	ElasticIndex       string `ini:"elasticIndex"`       // elastic index 模板 logs-{service}-{date}，{date:2006.01} 指定日期格式
+	ElasticUsername    string `ini:"elasticUsername"`    // elastic basic 认证用户名
+	ElasticPassword    string `ini:"elasticPassword"`    // elastic basic 认证密码
+	ElasticAPIKey      string `ini:"elasticAPIKey"`      // elastic ApiKey 认证
+	OTLPEnable         bool   `ini:"otlpEnable"`         // 启用 OpenTelemetry OTLP/HTTP logs 输出，service.name 为 serviceName
+	OTLPEndpoint       string `ini:"otlpEndpoint"`       // otlp collector 地址 http://127.0.0.1:4318
+	OTLPEncoding       string `ini:"otlpEncoding"`       // otlp protobuf json
+	KafkaEnable        bool   `ini:"kafkaEnable"`        // 启用 kafka 输出
+	KafkaBrokers       string `ini:"kafkaBrokers"`       // kafka broker 地址，逗号分隔 127.0.0.1:9092
+	KafkaTopic         string `ini:"kafkaTopic"`         // kafka topic
+	KafkaKeyField      string `ini:"kafkaKeyField"`      // kafka 作为消息 key 的字段，如 request_id，为空时轮询分区
+	KafkaAcks          string `ini:"kafkaAcks"`          // kafka 0 1 all
+	KafkaCompression   string `ini:"kafkaCompression"`   // kafka none gzip
+	KafkaSpillFile     string `ini:"kafkaSpillFile"`     // kafka 不可用时写入的本地文件，按 maxSize maxBackups maxDays 切割
+	KafkaTLS           bool   `ini:"kafkaTLS"`           // kafka 使用 tls 连接 broker，证书使用 socketTLS* 配置
+	WebhookEnable      bool   `ini:"webhookEnable"`      // 启用 http webhook 输出
+	WebhookURL         string `ini:"webhookURL"`         // webhook 地址
+	WebhookLevel       string `ini:"webhookLevel"`       // webhook 最低级别，默认 errorFileLevel
+	WebhookFormat      string `ini:"webhookFormat"`      // webhook 请求体 json ndjson template
+	WebhookTemplate    string `ini:"webhookTemplate"`    // webhook text/template 模板，.Entries 为日志列表
+	WebhookHeaders     string `ini:"webhookHeaders"`     // webhook 额外请求头，逗号分隔 Key:Value
+	WebhookBearerToken string `ini:"webhookBearerToken"` // webhook Authorization: Bearer
+	WebhookUsername    string `ini:"webhookUsername"`    // webhook basic 认证用户名
+	WebhookPassword    string `ini:"webhookPassword"`    // webhook basic 认证密码
+	WebhookHMACSecret  string `ini:"webhookHMACSecret"`  // webhook 请求体 HMAC-SHA256 签名密钥，写入 X-Signature-256
+	WebhookMaxEntries  int    `ini:"webhookMaxEntries"`  // webhook 每个请求最多条数，0 为整批
+	WebhookConcurrency int    `ini:"webhookConcurrency"` // webhook 同时发送的请求数
 }
 
-// InitLogByFile 确保日志最先初始化 log.ini
+// InitLogByFile 确保日志最先初始化 log.ini，相对路径相对于可执行文件所在目录
+// 按扩展名支持 ini yaml json toml，未配置的项使用 GetDefaultConfig 的默认值
 func InitLogByFile(filename string) error {
-	runDir, _ := filepath.Abs(filepath.Dir(os.Args[0]))
-	dir := path.Join(runDir, filename)
-	var logConfig Config
-	p, err := ini.Load(dir)
+	return InitLogByFileSection(filename, "")
+}
+
+// InitLogByFileSection 确保日志最先初始化，读取配置文件中的嵌套配置节，如 logging
+func InitLogByFileSection(filename, section string) error {
+	dir := filename
+	if !filepath.IsAbs(filename) {
+		runDir, _ := filepath.Abs(filepath.Dir(os.Args[0]))
+		dir = path.Join(runDir, filename)
+	}
+	data, err := ioutil.ReadFile(dir)
 	if err != nil {
 		return fmt.Errorf("open config file dir [%s] failed: %v", dir, err)
 	}
-	if err := p.MapTo(logConfig); err != nil {
+	logConfig, err := LoadConfig(data, FormatByExt(dir), section)
+	if err != nil {
+		return fmt.Errorf("load config file dir [%s] failed: %v", dir, err)
+	}
+	if err := ApplyEnv(&logConfig); err != nil {
 		return err
 	}
-	return InitLog(logConfig)
+	if err := InitLog(logConfig); err != nil {
+		return err
+	}
+	configFile.Store(watchedFile{path: dir, section: section})
+	return nil
 }
 
-// InitLogByReader 确保日志最先初始化
+// InitLogByReader 确保日志最先初始化 ini 格式
 func InitLogByReader(reader io.Reader) error {
-	var logConfig Config
-	p, err := ini.Load(reader)
+	return InitLogByReaderFormat(reader, FormatINI, "")
+}
+
+// InitLogByReaderFormat 确保日志最先初始化，按指定格式读取配置节
+func InitLogByReaderFormat(reader io.Reader, format ConfigFormat, section string) error {
+	logConfig, err := LoadConfigReader(reader, format, section)
 	if err != nil {
 		return fmt.Errorf("load config stream failed: %v", err)
 	}
-	if err := p.MapTo(logConfig); err != nil {
+	if err := ApplyEnv(&logConfig); err != nil {
 		return err
 	}
 	return InitLog(logConfig)
 }
 
-// InitLog 确保日志最先初始化
+// InitLog 确保日志最先初始化，Config 无效或输出创建失败时不替换默认 logger
 func InitLog(config Config) error {
-	t := NewZLogger(config)
-	mtx.Lock()
-	defaultLogger = t
-	mtx.Unlock()
+	if err := config.Validate(); err != nil {
+		return fmt.Errorf("invalid log config: %w", err)
+	}
+	t, err := newZLogger(config)
+	if err != nil {
+		_ = t.Close(context.Background())
+		return err
+	}
+	SetDefaultLogger(t)
 	return nil
 }
 
@@ -138,6 +246,9 @@ func GetDefaultConfig() Config {
 		MaxBackups:         15,
 		MaxDays:            15,
 		Compress:           true,
+		RotatePeriod:       RotateSize,
+		MaxTotalSize:       0,
+		MinFreeDisk:        0,
 		Level:              "debug",
 		StacktraceLevel:    "panic",
 		ErrorFileLevel:     "error",
@@ -148,19 +259,92 @@ func GetDefaultConfig() Config {
 		ConsoleLogger:      true,
 		FileLoggerJSON:     false,
 		ConsoleLoggerJSON:  false,
+		FileAsync:          false,
+		ConsoleAsync:       false,
+		SocketAsync:        false,
+		AsyncBufferSize:    defaultAsyncBufferSize,
+		AsyncPolicy:        AsyncBlock,
+		AsyncDropLevel:     "warn",
+		AsyncFlushInterval: 1000,
 		SocketLoggerEnable: false,
 		SocketLoggerJSON:   false,
 		SocketType:         "udp",
 		SocketIP:           "127.0.0.1",
 		SocketPort:         "9990",
+		SocketFraming:      FramingNewline,
+		SocketBufferSize:   defaultSocketBufferSize,
+		SyslogEnable:       false,
+		SyslogNetwork:      "unixgram",
+		SyslogFormat:       SyslogRFC5424,
+		SyslogFacility:     "user",
+		JournalEnable:      false,
+		GELFEnable:         false,
+		GELFNetwork:        "udp",
+		FluentEnable:       false,
+		FluentNetwork:      "tcp",
+		FluentRequireAck:   false,
+		LokiEnable:         false,
+		LokiFormat:         LokiProtobuf,
+		LokiLabels:         "service,level,logger",
+		ElasticEnable:      false,
+		ElasticIndex:       defaultElasticIndex,
+		OTLPEnable:         false,
+		OTLPEncoding:       OTLPProtobuf,
+		KafkaEnable:        false,
+		KafkaAcks:          KafkaAcksLeader,
+		KafkaCompression:   KafkaCompressNone,
+		KafkaTLS:           false,
+		WebhookEnable:      false,
+		WebhookFormat:      WebhookJSON,
+		WebhookConcurrency: 1,
 	}
 }
 
 // SetDefaultLogger implements
+// 被替换的默认 logger 的输出会被关闭，新旧 logger 共享输出时(如 With 派生)不关闭
+// 未初始化时按默认配置创建的默认 logger 被替换时，之前派生的 logger(如包级 var log = zlog.Named("x"))转发到新的默认 logger，
+// 使用新的输出和级别；用户创建的 logger 被替换后只关闭输出，不转发
 func SetDefaultLogger(logger Logger) {
 	mtx.Lock()
-	defaultLogger = logger
+	old, lazy := defaultLogger, defaultLazy
+	defaultLogger, defaultLazy = logger, false
+	var replaced *coreState
+	shared := old == nil || sameOutputs(old, logger)
+	if !shared && lazy {
+		zo, ok := unwrapZLogger(old)
+		zn, okNew := unwrapZLogger(logger)
+		if ok && okNew {
+			replaced = zo.h.resolve().forward(zn.h.resolve())
+		}
+	}
 	mtx.Unlock()
+	if shared {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), replaceCloseTimeout)
+	defer cancel()
+	var err error
+	if replaced != nil {
+		err = closeState(ctx, replaced)
+	} else {
+		err = old.Close(ctx)
+	}
+	if err != nil {
+		logger.Errorf("close replaced default logger failed: %v", err)
+	}
+}
+
+// sameOutputs 两个 logger 是否共享同一组输出
+func sameOutputs(a, b Logger) bool {
+	if a == b {
+		return true
+	}
+	za, ok := unwrapZLogger(a)
+	if !ok {
+		return false
+	}
+	zb, ok := unwrapZLogger(b)
+	return ok && za.h.resolve() == zb.h.resolve()
 }
 
 // GetDefaultLogger defaults logger
@@ -171,24 +355,134 @@ func GetDefaultLogger() Logger {
 	if l != nil {
 		return l
 	}
-	t := NewZLogger(GetDefaultConfig())
+	// 未初始化时使用默认配置 + 环境变量，无效的环境变量不生效并输出错误日志
+	cfg := GetDefaultConfig()
+	envErr := ApplyEnv(&cfg)
 	mtx.Lock()
-	defaultLogger = t
+	if defaultLogger != nil {
+		l = defaultLogger
+		mtx.Unlock()
+		return l
+	}
+	t := NewZLogger(cfg)
+	defaultLogger, defaultLazy = t, true
 	mtx.Unlock()
+	if envErr != nil {
+		t.Errorf("apply env config failed: %v", envErr)
+	}
 	return t
 }
 
 type zLogger struct {
 	logger      *zap.Logger
+	name        string      // 命名 logger 的完整名称 payments.gateway
+	h           *coreHolder // 可热加载的输出 core 和级别，With Named 派生的子 logger 共享
 	shortCaller bool
 }
 
+// outputs getCore New 创建的输出
+type outputs struct {
+	files   []*outputFile  // 日志文件，reopen 后下次写入重新打开
+	closers []io.Closer    // socket 等其他需要关闭的输出
+	async   []*AsyncWriter // 异步输出，先于文件和 socket 关闭
+	disk    *diskGuard     // 日志总大小与磁盘剩余空间限制，由 closers 关闭
+}
+
+// limitDisk 文件输出加入磁盘限制，所有文件共用一个 diskGuard，创建后需调用 disk.start
+func (o *outputs) limitDisk(limit DiskLimit, path string, w io.Writer, core zapcore.Core) zapcore.Core {
+	if o.disk == nil {
+		o.disk = newDiskGuard(limit)
+		o.closers = append(o.closers, o.disk)
+	}
+	return o.disk.add(path, w, core)
+}
+
+// close 关闭所有输出
+func (o *outputs) close() error {
+	var errs []error
+	for _, w := range o.async {
+		_ = w.Close()
+	}
+	for _, c := range o.closers {
+		if err := c.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	for _, f := range o.files {
+		if err := f.shutdown(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// addFile 加入日志文件，返回写入 w 的 outputFile
+func (o *outputs) addFile(w io.WriteCloser) *outputFile {
+	f := &outputFile{w: w}
+	o.files = append(o.files, f)
+	return f
+}
+
+// outputFile 日志文件，Close 后下次写入重新打开，shutdown 等待进行中的写入完成后关闭，之后的写入返回 os.ErrClosed
+// lumberjack 与 TimeRotateWriter 关闭后写入会重新打开文件，输出已关闭时不能再写入
+type outputFile struct {
+	mu     sync.RWMutex
+	w      io.WriteCloser
+	closed bool
+}
+
+// Write implements io.Writer.
+func (f *outputFile) Write(p []byte) (int, error) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	if f.closed {
+		return 0, os.ErrClosed
+	}
+	return f.w.Write(p)
+}
+
+// Close implements io.Closer. 关闭当前文件，下次写入重新打开
+func (f *outputFile) Close() error {
+	return f.w.Close()
+}
+
+func (f *outputFile) shutdown() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.closed = true
+	return f.w.Close()
+}
+
+// reopen 关闭当前日志文件，下次写入时按原文件名重新打开，配合外部 logrotate 使用
+func (o *outputs) reopen() error {
+	var err error
+	for _, f := range o.files {
+		if e := f.Close(); e != nil && err == nil {
+			err = e
+		}
+	}
+	return err
+}
+
 // NewZLogger creates a new logger
+// 不校验 Config，socket 等输出创建失败时打印错误并忽略该输出，需要校验时使用 InitLog
 func NewZLogger(logConfig Config) Logger {
+	z, err := newZLogger(logConfig)
+	if err != nil {
+		fmt.Println("err", err.Error())
+	}
+	return z
+}
+
+// newZLogger 创建 logger，输出创建失败时返回 error 以及忽略该输出的 logger
+func newZLogger(logConfig Config) (*zLogger, error) {
+	core, out, err := getCore(logConfig)
+	h := newCoreHolder(logConfig, core, out)
 	return &zLogger{
-		logger:      getLogger(logConfig),
+		logger:      newZapLogger(h, callerSkipNum),
+		h:           h,
 		shortCaller: logConfig.ShortCaller,
-	}
+	}, err
 }
 
 // Sync 在默认情况下，日志记录器是没有缓冲的。但是在进程退出之前调用 Sync() 方法是一个好习惯。
@@ -197,9 +491,107 @@ func (z *zLogger) Sync() error {
 }
 
 // SetLevel set the output log level.
+// 命名 logger 设置的是自己名称在所属根 logger 中的前缀级别覆盖
 func (z *zLogger) SetLevel(level Level) {
-	v := levelToZapLevel[level]
-	atomLevel.SetLevel(v)
+	if z.name != "" {
+		if v, ok := levelToZapLevel[level]; ok {
+			z.h.resolve().levels.set(z.name, v)
+		}
+		return
+	}
+	v, ok := levelToZapLevel[level]
+	if !ok {
+		return
+	}
+	z.h.resolve().level.SetLevel(v)
+}
+
+// GetLevel get the output log level.
+func (z *zLogger) GetLevel() Level {
+	return zapLevelToLevel[namedLevel{name: z.name, h: z.h}.Level()]
+}
+
+// Reopen 重新打开日志文件 LogFileName ErrorFileName
+func (z *zLogger) Reopen() error {
+	return z.h.load().out.reopen()
+}
+
+// AsyncDropped 异步输出队列已满或关闭后丢弃的日志条数，热加载后重新计数
+func (z *zLogger) AsyncDropped() uint64 {
+	var n uint64
+	for _, w := range z.h.load().out.async {
+		n += w.Dropped()
+	}
+	return n
+}
+
+// SinkDropped socket fluent loki elastic otlp kafka webhook 等输出缓存已满、超过重试次数或被服务端拒绝而丢弃的日志条数之和
+// 不含异步队列丢弃的条数，热加载后重新计数
+func (z *zLogger) SinkDropped() uint64 {
+	var n uint64
+	for _, c := range z.h.load().out.closers {
+		if d, ok := c.(interface{ Dropped() uint64 }); ok {
+			n += d.Dropped()
+		}
+	}
+	return n
+}
+
+// Reload 按新 Config 重建输出 core 并原子替换，已有 With 派生的子 logger 同样生效
+// Config 无效或输出创建失败时保留之前的配置
+func (z *zLogger) Reload(logConfig Config) error {
+	if err := logConfig.Validate(); err != nil {
+		return fmt.Errorf("invalid log config: %w", err)
+	}
+	core, out, err := getCore(logConfig)
+	if err != nil {
+		_ = out.close()
+		return err
+	}
+	old := z.h.swap(logConfig, core, out)
+	z.h.resolve().level.SetLevel(getLevel(logConfig.Level))
+	_ = old.core.Sync()
+	return old.out.close()
+}
+
+// Close 刷新并关闭所有输出，之后的日志被丢弃
+// With Named 派生的子 logger 共享输出，关闭任意一个即全部关闭
+func (z *zLogger) Close(ctx context.Context) error {
+	return closeState(ctx, z.h.swap(z.h.load().config, zapcore.NewNopCore(), &outputs{}))
+}
+
+// closeState 刷新并关闭 st 的输出，ctx 结束时返回，关闭在后台继续
+func closeState(ctx context.Context, st *coreState) error {
+	done := make(chan error, 1)
+	go func() {
+		err := st.core.Sync()
+		if e := st.out.close(); e != nil {
+			err = errors.Join(err, e)
+		}
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Named adds a new path segment to the logger's name. Segments are joined by periods.
+func (z *zLogger) Named(name string) Logger {
+	if name == "" {
+		return z
+	}
+	n := *z
+	if n.name == "" {
+		n.name = name
+	} else {
+		n.name = n.name + "." + name
+	}
+	n.h.resolve().levels.register(n.name)
+	n.logger = withLevel(n.logger.Named(name), namedLevel{name: n.name, h: n.h})
+	return &zLogWrapper{logger: &n}
 }
 
 // Println 打印日志到终端
@@ -436,8 +828,10 @@ func newTimeEncoder(format string) zapcore.TimeEncoder {
 		return zapcore.EpochMillisTimeEncoder
 	case "nanoseconds":
 		return zapcore.EpochNanosTimeEncoder
-	case "utc":
-		return zapcore.ISO8601TimeEncoder // ISO8601 UTC 时间格式
+	case "utc", "iso8601":
+		return zapcore.ISO8601TimeEncoder // ISO8601 时间格式
+	case "rfc3339":
+		return zapcore.RFC3339NanoTimeEncoder
 	default:
 		return func(t time.Time, enc zapcore.PrimitiveArrayEncoder) {
 			//enc.AppendString("[" + t.Format("2006-01-02 15:04:05.000000") + "]")
@@ -508,53 +902,98 @@ func getCallerInfo(stackNum int, shortPath bool) string {
 	return where
 }
 
-func getLogger(logConfig Config) *zap.Logger {
-	op := EncoderOption{timeFmt: "json", colorLevel: false, shortCaller: logConfig.ShortCaller,
+// stdoutWriter 终端输出，终端和管道上 fsync 会返回 invalid argument，Sync 不做操作
+func stdoutWriter() zapcore.WriteSyncer {
+	return zapcore.Lock(zapcore.AddSync(struct{ io.Writer }{os.Stdout}))
+}
+
+// configTLS socket syslog gelf fluent kafka 共用的 tls 证书配置
+func configTLS(logConfig Config) (*tls.Config, error) {
+	return TLSOptions{
+		CAFile:     logConfig.SocketTLSCA,
+		CertFile:   logConfig.SocketTLSCert,
+		KeyFile:    logConfig.SocketTLSKey,
+		ServerName: logConfig.SocketTLSServer,
+		MinVersion: logConfig.SocketTLSMinVer,
+	}.Config()
+}
+
+// configTimeFmt file console socket 的时间格式，timeFormat 为空时使用 custom
+func configTimeFmt(logConfig Config) string {
+	if logConfig.TimeFormat == "" {
+		return "custom"
+	}
+	return strings.ToLower(logConfig.TimeFormat)
+}
+
+// configAsync enable 时按 Config 返回异步输出选项
+func configAsync(logConfig Config, enable bool) *AsyncOptions {
+	if !enable {
+		return nil
+	}
+	return &AsyncOptions{
+		BufferSize:    logConfig.AsyncBufferSize,
+		Policy:        logConfig.AsyncPolicy,
+		DropLevel:     LevelNames[strings.ToLower(logConfig.AsyncDropLevel)],
+		FlushInterval: time.Duration(logConfig.AsyncFlushInterval) * time.Millisecond,
+	}
+}
+
+// getCore 按 Config 创建输出 core，level 过滤与 zap.Logger 选项由 newZapLogger 负责
+// socket syslog gelf fluent loki elastic otlp kafka webhook journald 等输出创建失败时返回 error 以及不含该输出的 core
+func getCore(logConfig Config) (zapcore.Core, *outputs, error) {
+	op := EncoderOption{timeFmt: configTimeFmt(logConfig), colorLevel: false, shortCaller: logConfig.ShortCaller,
 		function: logConfig.FunctionEnable}
 	//[1]文件log hook MaxBackups和MaxAge 任意达到限制，对应的文件就会被清理
-	hookAll := lumberjack.Logger{
-		Filename:   logConfig.LogFileName, // 日志文件路径 ./log/log.log
-		MaxSize:    logConfig.MaxSize,     // 最大文件大小 M字节
-		MaxBackups: logConfig.MaxBackups,  // 最多保留3个备份
-		MaxAge:     logConfig.MaxDays,     // 文件最多保存多少天
-		Compress:   logConfig.Compress,    // 是否压缩 disabled by default
-	}
-	hookError := lumberjack.Logger{
-		Filename:   logConfig.ErrorFileName, // 日志文件路径 ./log/error.log
-		MaxSize:    logConfig.MaxSize,       // 最大文件大小 M字节
-		MaxBackups: logConfig.MaxBackups,    // 最多保留3个备份
-		MaxAge:     logConfig.MaxDays,       // 文件最多保存多少天
-		Compress:   logConfig.Compress,      // 是否压缩 disabled by default
-	}
-	//[2]设置level 动态level
-	atomLevel = zap.NewAtomicLevel()
-	atomLevel.SetLevel(getLevel(logConfig.Level))
-	var errorLevel zapcore.Level
-	if logConfig.ErrorFileLevel == "error" {
-		errorLevel = zapcore.ErrorLevel
-	} else {
-		errorLevel = zapcore.WarnLevel
+	out := &outputs{}
+	rotation := Rotation{
+		MaxSize:    logConfig.MaxSize,    // 最大文件大小 M字节
+		MaxBackups: logConfig.MaxBackups, // 最多保留3个备份
+		MaxDays:    logConfig.MaxDays,    // 文件最多保存多少天
+		Compress:   logConfig.Compress,   // 是否压缩 disabled by default
+		Period:     logConfig.RotatePeriod,
+	}
+	//[2]设置level 动态level 由 newZapLogger 创建，每个 logger 独立，在 tee 外层统一过滤
+	errorLevel := zapcore.WarnLevel
+	if logConfig.ErrorFileLevel != "" {
+		errorLevel = getLevel(logConfig.ErrorFileLevel)
 	}
 	//[3]配置多个输出方式
-	//TCP 没解决 当服务器断开，重连的问题
-	//UDP 不存在这样的问题
+	//UDP 直接发送，TCP TLS 断线后按指数退避重连，断线期间缓存有限条数的日志
 	var socketCore zapcore.Core
+	var socketErr error
 	if logConfig.SocketLoggerEnable {
-		addr := fmt.Sprintf("%s:%s", logConfig.SocketIP, logConfig.SocketPort)
-		conn, err := net.DialTimeout("udp", addr, 3*time.Second)
+		addr := net.JoinHostPort(logConfig.SocketIP, logConfig.SocketPort)
+		if isUnixSocket(logConfig.SocketType) {
+			addr = logConfig.SocketPath
+		}
+		stream := StreamOptions{
+			Framing:    logConfig.SocketFraming,
+			BufferSize: logConfig.SocketBufferSize,
+		}
+		var err error
+		if strings.EqualFold(logConfig.SocketType, "tls") {
+			stream.TLS, err = configTLS(logConfig)
+		}
+		var conn io.WriteCloser
+		if err == nil {
+			conn, err = newSocketWriter(logConfig.SocketType, addr, stream)
+		}
 		if err != nil {
-			fmt.Println("err", logConfig.SocketType, addr, err.Error())
+			socketErr = fmt.Errorf("dial %s socket %s failed: %v", logConfig.SocketType, addr, err)
 		} else {
-			// read or write on conn
-			//defer conn.Close()
+			// read or write on conn 由 outputs.close 关闭
+			out.closers = append(out.closers, conn)
 			wSocket := zapcore.AddSync(conn)
 			if logConfig.SocketLoggerJSON {
-				socketEncoder := newEncoder(op)
-				socketCore = zapcore.NewCore(socketEncoder, wSocket, atomLevel)
+				op.formatter = "json"
 			} else {
 				op.formatter = ""
-				socketEncoder := newEncoder(op)
-				socketCore = zapcore.NewCore(socketEncoder, wSocket, atomLevel)
+			}
+			socketCore, err = newSinkCore("socket "+addr, newEncoder(op), wSocket, zapcore.DebugLevel, configAsync(logConfig, logConfig.SocketAsync), out)
+			if err != nil {
+				socketErr = fmt.Errorf("socket %s: %v", addr, err)
+				socketCore = nil
 			}
 		}
 	}
@@ -564,16 +1003,32 @@ func getLogger(logConfig Config) *zap.Logger {
 	var allWriter zapcore.WriteSyncer
 	var errorWriter zapcore.WriteSyncer
 	if logConfig.ConsoleLogger {
-		consoleWriter = zapcore.Lock(os.Stdout)
+		consoleWriter = stdoutWriter()
 	} else {
 		consoleWriter = zapcore.AddSync(ioutil.Discard)
 	}
+	var fileErr error
+	var hookAll, hookError io.WriteCloser
 	if logConfig.FileLogger {
-		allWriter = zapcore.AddSync(&hookAll)
+		// 切割周期无效时按大小切割并返回 error
+		var err error
+		hookAll, err = newRotateFile(logConfig.LogFileName, rotation)
+		if err != nil {
+			fileErr = fmt.Errorf("logFileName: %v", err)
+			rotation.Period = RotateSize
+			hookAll, _ = newRotateFile(logConfig.LogFileName, rotation)
+		}
+		allWriter = zapcore.AddSync(out.addFile(hookAll))
+		errorWriter = zapcore.AddSync(ioutil.Discard)
 		if logConfig.ErrorFileEnable {
-			errorWriter = zapcore.AddSync(&hookError)
-		} else {
-			errorWriter = zapcore.AddSync(ioutil.Discard)
+			hookError, err = newRotateFile(logConfig.ErrorFileName, rotation)
+			if err != nil {
+				// 不写 errorFileName，其他输出不受影响
+				fileErr = errors.Join(fileErr, fmt.Errorf("errorFileName: %v", err))
+				hookError = nil
+			} else {
+				errorWriter = zapcore.AddSync(out.addFile(hookError))
+			}
 		}
 	} else {
 		allWriter = zapcore.AddSync(ioutil.Discard)
@@ -594,37 +1049,150 @@ func getLogger(logConfig Config) *zap.Logger {
 	if logConfig.ConsoleLoggerJSON {
 		consoleEncoder = jsonEncoder
 	}
-	// Join the outputs, encoders, and level-handling functions into zapcore.Cores, then tee the four cores together.
-	var core zapcore.Core
+	// Join the outputs, encoders, and level-handling functions into zapcore.Cores, then tee the cores together.
+	// 异步输出创建失败时使用同步输出并返回 error
+	var sinkErrs []error
+	if fileErr != nil {
+		sinkErrs = append(sinkErrs, fileErr)
+	}
+	if socketErr != nil {
+		sinkErrs = append(sinkErrs, socketErr)
+	}
+	newCore := func(name string, enc zapcore.Encoder, ws zapcore.WriteSyncer, enab zapcore.LevelEnabler, async *AsyncOptions) zapcore.Core {
+		c, err := newSinkCore(name, enc, ws, enab, async, out)
+		if err != nil {
+			sinkErrs = append(sinkErrs, fmt.Errorf("%s: %v", name, err))
+			return zapcore.NewCore(enc, ws, enab)
+		}
+		return c
+	}
+	fileAsync := configAsync(logConfig, logConfig.FileLogger && logConfig.FileAsync)
+	cores := []zapcore.Core{
+		newCore(logConfig.LogFileName, fileEncoder, allWriter, zapcore.DebugLevel, fileAsync),
+		newCore(logConfig.ErrorFileName, fileEncoder, errorWriter, errorLevel, configAsync(logConfig, logConfig.ErrorFileEnable && fileAsync != nil)),
+		newCore("console", consoleEncoder, consoleWriter, zapcore.DebugLevel, configAsync(logConfig, logConfig.ConsoleLogger && logConfig.ConsoleAsync)),
+	}
+	if logConfig.FileLogger && (logConfig.MaxTotalSize > 0 || logConfig.MinFreeDisk > 0) {
+		limit := DiskLimit{MaxTotalSize: logConfig.MaxTotalSize, MinFreeDisk: logConfig.MinFreeDisk}
+		cores[0] = out.limitDisk(limit, logConfig.LogFileName, hookAll, cores[0])
+		if hookError != nil {
+			cores[1] = out.limitDisk(limit, logConfig.ErrorFileName, hookError, cores[1])
+		}
+		out.disk.start()
+	}
 	if socketCore != nil {
-		core = zapcore.NewTee(
-			socketCore,
-			zapcore.NewCore(fileEncoder, allWriter, atomLevel),
-			zapcore.NewCore(fileEncoder, errorWriter, errorLevel),
-			zapcore.NewCore(consoleEncoder, consoleWriter, atomLevel),
-		)
-	} else {
-		core = zapcore.NewTee(
-			zapcore.NewCore(fileEncoder, allWriter, atomLevel),
-			zapcore.NewCore(fileEncoder, errorWriter, errorLevel),
-			zapcore.NewCore(consoleEncoder, consoleWriter, atomLevel),
-		)
-	}
-	//[4]创建日志logger 设置初始化字段 service key
-	filed := zap.Fields()
+		cores = append([]zapcore.Core{socketCore}, cores...)
+	}
+	if logConfig.SyslogEnable {
+		c, closer, err := newConfigSyslogCore(logConfig)
+		if err != nil {
+			sinkErrs = append(sinkErrs, err)
+		} else {
+			out.closers = append(out.closers, closer)
+			cores = append(cores, c)
+		}
+	}
+	if logConfig.GELFEnable {
+		c, closer, err := newConfigGELFCore(logConfig)
+		if err != nil {
+			sinkErrs = append(sinkErrs, err)
+		} else {
+			out.closers = append(out.closers, closer)
+			cores = append(cores, c)
+		}
+	}
+	if logConfig.FluentEnable {
+		c, closer, err := newConfigFluentCore(logConfig)
+		if err != nil {
+			sinkErrs = append(sinkErrs, err)
+		} else {
+			out.closers = append(out.closers, closer)
+			cores = append(cores, c)
+		}
+	}
+	if logConfig.LokiEnable {
+		c, closer, err := newConfigLokiCore(logConfig)
+		if err != nil {
+			sinkErrs = append(sinkErrs, err)
+		} else {
+			out.closers = append(out.closers, closer)
+			cores = append(cores, c)
+		}
+	}
+	if logConfig.ElasticEnable {
+		c, closer, err := NewElasticCore(ElasticOptions{
+			URL:        logConfig.ElasticURL,
+			Index:      logConfig.ElasticIndex,
+			ServiceKey: logConfig.ServiceKey,
+			Username:   logConfig.ElasticUsername,
+			Password:   logConfig.ElasticPassword,
+			APIKey:     logConfig.ElasticAPIKey,
+		}, newEncoder(EncoderOption{formatter: "json", timeFmt: "rfc3339", shortCaller: logConfig.ShortCaller, function: logConfig.FunctionEnable}))
+		if err != nil {
+			sinkErrs = append(sinkErrs, fmt.Errorf("elasticsearch: %v", err))
+		} else {
+			out.closers = append(out.closers, closer)
+			cores = append(cores, c)
+		}
+	}
+	if logConfig.OTLPEnable {
+		c, closer, err := NewOTLPCore(OTLPOptions{
+			Endpoint:    logConfig.OTLPEndpoint,
+			Encoding:    logConfig.OTLPEncoding,
+			ServiceName: logConfig.ServiceName,
+		})
+		if err != nil {
+			sinkErrs = append(sinkErrs, fmt.Errorf("otlp: %v", err))
+		} else {
+			out.closers = append(out.closers, closer)
+			cores = append(cores, c)
+		}
+	}
+	if logConfig.KafkaEnable {
+		c, closer, err := newConfigKafkaCore(logConfig)
+		if err != nil {
+			sinkErrs = append(sinkErrs, err)
+		} else {
+			out.closers = append(out.closers, closer)
+			cores = append(cores, c)
+		}
+	}
+	if logConfig.WebhookEnable {
+		c, closer, err := newConfigWebhookCore(logConfig)
+		if err != nil {
+			sinkErrs = append(sinkErrs, err)
+		} else {
+			out.closers = append(out.closers, closer)
+			cores = append(cores, c)
+		}
+	}
+	if logConfig.JournalEnable {
+		c, closer, err := NewJournalCore(JournalOptions{SyslogIdentifier: logConfig.ServiceName})
+		if err != nil {
+			sinkErrs = append(sinkErrs, fmt.Errorf("journald: %v", err))
+		} else {
+			out.closers = append(out.closers, closer)
+			cores = append(cores, c)
+		}
+	}
+	core := zapcore.NewTee(cores...)
+	//[4]设置初始化字段 service key，放在 core 上，热加载时随 core 一起替换
 	if logConfig.ServiceKey == "" {
 		logConfig.ServiceKey = "service"
 	}
 	if len(logConfig.ServiceName) != 0 {
-		filed = zap.Fields(zap.String("service", logConfig.ServiceName))
+		core = core.With([]zapcore.Field{zap.String(logConfig.ServiceKey, logConfig.ServiceName)})
 	}
+	return core, out, errors.Join(sinkErrs...)
+}
+
+// newZapLogger 创建 zap.Logger，core 外层依次包装 热加载 reloadCore 和 级别过滤 levelCore
+func newZapLogger(h *coreHolder, callerSkip int, opts ...zap.Option) *zap.Logger {
+	core := &levelCore{Core: &reloadCore{h: h}, level: namedLevel{h: h}}
 	// zap.Logger.Info("") 为 0 层
 	// With 调用链使用的 Info 接口 ，比直接 Info 少一层 , With需要 we can add a layer to the debug
 	//series function calls, so that the caller information can be set correctly.
-	logger := zap.New(core, zap.Development(), zap.AddCaller(), zap.AddCallerSkip(callerSkipNum), zap.AddStacktrace(getLevel(logConfig.StacktraceLevel)), filed)
 	//输出调用堆栈 主要是调用函数 zap.AddStacktrace()
-	//defer logger.Sync()
-	//logger.Info("default logger init " + logConfig.Level + " success")
-	//logger.Error("default logger init " + logConfig.Level + " success")
-	return logger
+	opts = append([]zap.Option{zap.Development(), zap.AddCaller(), zap.AddCallerSkip(callerSkip), zap.AddStacktrace(stackLevel{h: h})}, opts...)
+	return zap.New(core, opts...)
 }